@@ -0,0 +1,801 @@
+package libdatamanager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ArchiveFormat format of archived folders
+type ArchiveFormat string
+
+// Archive formats
+const (
+	ArchiveTar     ArchiveFormat = "tar"
+	ArchiveTarGzip ArchiveFormat = "tar.gz"
+	ArchiveTarZstd ArchiveFormat = "tar.zst"
+	ArchiveZip     ArchiveFormat = "zip"
+)
+
+// LinkMode how symlinks are archived
+type LinkMode uint8
+
+// Link modes
+const (
+	// LinksPreserve archive symlinks as links
+	LinksPreserve LinkMode = iota
+
+	// LinksFollow archive the files symlinks point to
+	LinksFollow
+
+	// LinksSkip don't archive symlinks
+	LinksSkip
+)
+
+const (
+	// Prefix of PAX records containing extended attributes
+	paxXattrPrefix = "SCHILY.xattr."
+
+	// Prefix of PAX records describing sparse files and a placeholder
+	// of the same length, since the tar writer drops those records
+	paxSparsePrefix      = "GNU.sparse."
+	paxSparsePlaceholder = "DMS.sparse."
+
+	tarBlockSize = 512
+)
+
+// ReproducibleModTime modification time of all
+// entries in reproducible archives. Zip can't
+// store times before 1980
+var ReproducibleModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// MaxArchiveErrors count of files which may fail to be
+// archived before archiving the folder fails
+var MaxArchiveErrors = 10
+
+var (
+	// ErrArchiveFormatNotSupported if the archive format is not supported
+	ErrArchiveFormatNotSupported = errors.New("archive format not supported")
+	// ErrTooManyArchiveErrors if more than MaxArchiveErrors files failed to be archived
+	ErrTooManyArchiveErrors = errors.New("too many errors")
+)
+
+// ArchiveError a file which couldn't be archived and got skipped
+type ArchiveError struct {
+	Path string
+	Err  error
+}
+
+func (err *ArchiveError) Error() string {
+	return err.Path + ": " + err.Err.Error()
+}
+
+func (err *ArchiveError) Unwrap() error {
+	return err.Err
+}
+
+// ArchiveErrorCallback gets called for each file skipped due to an error
+type ArchiveErrorCallback func(*ArchiveError)
+
+// archiveErrors counts the files which failed to be archived
+type archiveErrors struct {
+	callback ArchiveErrorCallback
+	count    int
+}
+
+// add reports a skipped file. Returns ErrTooManyArchiveErrors
+// if more than MaxArchiveErrors files got skipped
+func (errs *archiveErrors) add(err *ArchiveError) error {
+	if errs.callback != nil {
+		errs.callback(err)
+	}
+
+	errs.count++
+	if errs.count > MaxArchiveErrors {
+		return ErrTooManyArchiveErrors
+	}
+
+	return nil
+}
+
+// ArchiveOptions options for archiving a folder. Include and Exclude
+// take gitignore style patterns which are matched against the path
+// relative to the archived folder. If Include is set, only matching
+// files get archived. MaxFileSize skips bigger files if > 0.
+// Sockets and other files which can't be stored in the format are
+// skipped. Unreadable files are skipped and reported as ArchiveError.
+// Reproducible archives only depend on the names, types, contents,
+// link targets and executable bits of the files: entries are sorted,
+// timestamps, owners and permissions are normalized, hardlinked files
+// are stored as separate files, Xattrs and Sparse are ignored and tar
+// uses the PAX format. Their checksum can be used as fingerprint of
+// the folder. Otherwise hardlinks, modes and owners are kept in tar
+// archives. Xattrs (including ACLs) and holes of sparse files are
+// only stored in tar archives if enabled and supported by the OS
+type ArchiveOptions struct {
+	Format             ArchiveFormat
+	Include            []string
+	Exclude            []string
+	DisableIgnoreFiles bool
+	MaxFileSize        int64
+	Reproducible       bool
+	Links              LinkMode
+	Xattrs             bool
+	Sparse             bool
+}
+
+// GetFormat returns the archive format, tar if not set
+func (options ArchiveOptions) GetFormat() ArchiveFormat {
+	if len(options.Format) == 0 {
+		return ArchiveTar
+	}
+
+	return options.Format
+}
+
+// archiveEntry a file to be written into an archive
+type archiveEntry struct {
+	Path     string
+	Name     string
+	Info     os.FileInfo
+	Link     string
+	Hardlink string
+}
+
+// collectArchiveEntries returns all files in src which
+// have to be archived using the given options
+func collectArchiveEntries(src string, options ArchiveOptions, errs *archiveErrors) ([]archiveEntry, error) {
+	include, err := compilePathPatterns(options.Include)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := compilePathPatterns(options.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	src = filepath.Clean(src)
+	fi, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := &archiveCollector{
+		options:  options,
+		include:  include,
+		exclude:  exclude,
+		ignore:   newIgnoreMatcher(src),
+		rootName: filepath.Base(src),
+		parents:  make(map[fileID]bool),
+		errs:     errs,
+	}
+
+	if err := collector.walk(src, ".", fi); err != nil {
+		return nil, err
+	}
+
+	entries := collector.entries
+	if options.Reproducible {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name < entries[j].Name
+		})
+	}
+
+	return entries, nil
+}
+
+// archiveCollector collects the entries of an archived folder
+type archiveCollector struct {
+	options  ArchiveOptions
+	include  []*pathPattern
+	exclude  []*pathPattern
+	ignore   *ignoreMatcher
+	rootName string
+	parents  map[fileID]bool
+	entries  []archiveEntry
+	errs     *archiveErrors
+}
+
+// skip reports file as skipped due to err. The
+// folder itself can't be skipped
+func (collector *archiveCollector) skip(file, rel string, err error) error {
+	if rel == "." {
+		return err
+	}
+
+	return collector.errs.add(&ArchiveError{
+		Path: file,
+		Err:  err,
+	})
+}
+
+// archivable returns true if files with mode can be stored in the archive
+func (collector *archiveCollector) archivable(mode os.FileMode) bool {
+	switch {
+	case mode.IsRegular(), mode.IsDir(), mode&os.ModeSymlink != 0:
+		return true
+	case mode&(os.ModeNamedPipe|os.ModeDevice) != 0:
+		// Zip only stores files, folders and links
+		return collector.options.GetFormat() != ArchiveZip
+	}
+
+	return false
+}
+
+// walk adds file and its content if it's a directory. rel is
+// the slash separated path of file relative to the folder
+func (collector *archiveCollector) walk(file, rel string, fi os.FileInfo) error {
+	options := collector.options
+
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		switch options.Links {
+		case LinksSkip:
+			return nil
+		case LinksFollow:
+			// Keep dangling links as they are
+			if target, err := os.Stat(file); err == nil {
+				fi = target
+				break
+			}
+			fallthrough
+		default:
+			var err error
+			if link, err = os.Readlink(file); err != nil {
+				return collector.skip(file, rel, err)
+			}
+		}
+	}
+
+	if !collector.archivable(fi.Mode()) {
+		return nil
+	}
+
+	if rel != "." {
+		if matchAny(collector.exclude, rel, fi.IsDir()) ||
+			(!options.DisableIgnoreFiles && collector.ignore.ignored(rel, fi.IsDir())) {
+			return nil
+		}
+
+		if !fi.IsDir() {
+			if len(collector.include) > 0 && !matchAny(collector.include, rel, false) {
+				return nil
+			}
+
+			if options.MaxFileSize > 0 && fi.Mode().IsRegular() && fi.Size() > options.MaxFileSize {
+				return nil
+			}
+
+			// Skip unreadable files before they are counted into the size
+			if fi.Mode().IsRegular() {
+				f, err := os.Open(file)
+				if err != nil {
+					return collector.skip(file, rel, err)
+				}
+				f.Close()
+			}
+		}
+
+		collector.entries = append(collector.entries, archiveEntry{
+			Path: file,
+			Name: path.Join(collector.rootName, rel),
+			Info: fi,
+			Link: link,
+		})
+	}
+
+	if !fi.IsDir() {
+		return nil
+	}
+
+	// Followed links can point to a parent dir
+	if id, ok := getFileID(fi); ok {
+		if collector.parents[id] {
+			return nil
+		}
+
+		collector.parents[id] = true
+		defer delete(collector.parents, id)
+	}
+
+	// Use rules of the directory for its content
+	if !options.DisableIgnoreFiles {
+		if err := collector.ignore.load(rel); err != nil {
+			return collector.skip(file, rel, err)
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return collector.skip(file, rel, err)
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return collector.skip(file, rel, err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := filepath.Join(file, name)
+		childInfo, err := os.Lstat(child)
+		if err != nil {
+			if err := collector.skip(child, path.Join(rel, name), err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := collector.walk(child, path.Join(rel, name), childInfo); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reproducibleMode returns the normalized permissions for mode
+func reproducibleMode(mode os.FileMode) os.FileMode {
+	switch {
+	case mode.IsDir():
+		return 0755
+	case mode&os.ModeSymlink != 0:
+		return 0777
+	case mode&0111 != 0:
+		return 0755
+	}
+
+	return 0644
+}
+
+// fileID identifies a file on a device
+type fileID struct {
+	Device uint64
+	Inode  uint64
+}
+
+// sparseSegment a segment of a sparse file containing data
+type sparseSegment struct {
+	Offset int64
+	Length int64
+}
+
+// archiveWriter writes entries into an archive. WriteEntry returns an
+// *ArchiveError if the entry was skipped before anything got written
+type archiveWriter interface {
+	WriteEntry(entry archiveEntry, content io.Reader) error
+	Close() error
+}
+
+// newArchiveWriter returns an archiveWriter for the given options
+func newArchiveWriter(options ArchiveOptions, w io.Writer) (archiveWriter, error) {
+	format := options.GetFormat()
+
+	switch format {
+	case ArchiveTar:
+		return &tarArchiveWriter{
+			Writer:  tar.NewWriter(w),
+			out:     w,
+			options: options,
+		}, nil
+	case ArchiveTarGzip, ArchiveTarZstd:
+		compression := CompressionGzip
+		if format == ArchiveTarZstd {
+			compression = CompressionZstd
+		}
+
+		compressor, err := newCompressWriter(compression, 0, w)
+		if err != nil {
+			return nil, err
+		}
+
+		return &tarArchiveWriter{
+			Writer:     tar.NewWriter(compressor),
+			out:        compressor,
+			compressor: compressor,
+			options:    options,
+		}, nil
+	case ArchiveZip:
+		return &zipArchiveWriter{
+			Writer:  zip.NewWriter(w),
+			options: options,
+		}, nil
+	}
+
+	return nil, ErrArchiveFormatNotSupported
+}
+
+// tarArchiveWriter writes (compressed) tar archives
+type tarArchiveWriter struct {
+	*tar.Writer
+	out        io.Writer
+	compressor io.WriteCloser
+	options    ArchiveOptions
+}
+
+func (writer *tarArchiveWriter) WriteEntry(entry archiveEntry, content io.Reader) error {
+	header, err := tarHeader(entry, writer.options)
+	if err != nil {
+		return &ArchiveError{Path: entry.Path, Err: err}
+	}
+
+	// Hardlinks have no content
+	if header.Typeflag == tar.TypeLink {
+		content = nil
+	}
+
+	// Store only the data of sparse files
+	if f, ok := content.(*os.File); ok && writer.options.Sparse {
+		segments, err := sparseSegments(f, entry.Info)
+		if err != nil {
+			return &ArchiveError{Path: entry.Path, Err: err}
+		}
+
+		if segments != nil {
+			return writer.writeSparse(header, f, segments)
+		}
+	}
+
+	if err := writer.WriteHeader(header); err != nil {
+		return err
+	}
+
+	// Files may grow while being archived
+	if content != nil {
+		_, err = io.CopyN(writer.Writer, content, header.Size)
+	}
+
+	return err
+}
+
+// tarHeader returns the tar header of entry
+func tarHeader(entry archiveEntry, options ArchiveOptions) (*tar.Header, error) {
+	header, err := tar.FileInfoHeader(entry.Info, entry.Link)
+	if err != nil {
+		return nil, err
+	}
+
+	header.Name = entry.Name
+	if entry.Info.IsDir() {
+		header.Name += "/"
+	}
+
+	// Store further links to the same file as hardlink
+	if len(entry.Hardlink) > 0 {
+		header.Typeflag = tar.TypeLink
+		header.Linkname = entry.Hardlink
+		header.Size = 0
+	}
+
+	if options.Xattrs && len(entry.Link) == 0 {
+		xattrs, err := readXattrs(entry.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, value := range xattrs {
+			if header.PAXRecords == nil {
+				header.PAXRecords = make(map[string]string)
+			}
+
+			header.PAXRecords[paxXattrPrefix+name] = value
+			header.Format = tar.FormatPAX
+		}
+	}
+
+	if options.Reproducible {
+		header.Format = tar.FormatPAX
+		header.ModTime = ReproducibleModTime
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "", ""
+		header.Mode = int64(reproducibleMode(entry.Info.Mode()))
+	}
+
+	return header, nil
+}
+
+// sparseHeader turns header into a header of the PAX 1.0 sparse
+// format and returns the map of data segments preceding the data
+func sparseHeader(header *tar.Header, segments []sparseSegment) []byte {
+	var sparseMap bytes.Buffer
+	var dataSize int64
+
+	fmt.Fprintf(&sparseMap, "%d\n", len(segments))
+	for _, segment := range segments {
+		fmt.Fprintf(&sparseMap, "%d\n%d\n", segment.Offset, segment.Length)
+		dataSize += segment.Length
+	}
+
+	// The map is padded to full blocks
+	sparseMap.Write(make([]byte, tarPadding(int64(sparseMap.Len()))))
+
+	if header.PAXRecords == nil {
+		header.PAXRecords = make(map[string]string)
+	}
+
+	header.Format = tar.FormatPAX
+	header.PAXRecords[paxSparsePlaceholder+"major"] = "1"
+	header.PAXRecords[paxSparsePlaceholder+"minor"] = "0"
+	header.PAXRecords[paxSparsePlaceholder+"name"] = header.Name
+	header.PAXRecords[paxSparsePlaceholder+"realsize"] = strconv.FormatInt(header.Size, 10)
+	header.Name = path.Join(path.Dir(header.Name), "GNUSparseFile.0", path.Base(header.Name))
+	header.Size = int64(sparseMap.Len()) + dataSize
+
+	return sparseMap.Bytes()
+}
+
+// encodeTarHeader returns the encoded header blocks. Sparse
+// records are encoded using the placeholder prefix
+func encodeTarHeader(header *tar.Header) ([]byte, error) {
+	var encoded bytes.Buffer
+	if err := tar.NewWriter(&encoded).WriteHeader(header); err != nil {
+		return nil, err
+	}
+
+	return encoded.Bytes(), nil
+}
+
+// tarPadding returns the count of bytes required to fill the last block
+func tarPadding(size int64) int64 {
+	if rest := size % tarBlockSize; rest != 0 {
+		return tarBlockSize - rest
+	}
+
+	return 0
+}
+
+// writeSparse writes f using the PAX 1.0 sparse format
+func (writer *tarArchiveWriter) writeSparse(header *tar.Header, f *os.File, segments []sparseSegment) error {
+	sparseMap := sparseHeader(header, segments)
+
+	// The tar writer drops the sparse records, so
+	// the header gets written directly into the archive
+	encoded, err := encodeTarHeader(header)
+	if err != nil {
+		return err
+	}
+	encoded = bytes.ReplaceAll(encoded, []byte(" "+paxSparsePlaceholder), []byte(" "+paxSparsePrefix))
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := writer.out.Write(encoded); err != nil {
+		return err
+	}
+
+	if _, err := writer.out.Write(sparseMap); err != nil {
+		return err
+	}
+
+	var dataSize int64
+	for _, segment := range segments {
+		if _, err := io.Copy(writer.out, io.NewSectionReader(f, segment.Offset, segment.Length)); err != nil {
+			return err
+		}
+
+		dataSize += segment.Length
+	}
+
+	// Pad the data to full blocks
+	_, err = writer.out.Write(make([]byte, tarPadding(dataSize)))
+	return err
+}
+
+func (writer *tarArchiveWriter) Close() error {
+	if err := writer.Writer.Close(); err != nil {
+		return err
+	}
+
+	if writer.compressor != nil {
+		return writer.compressor.Close()
+	}
+
+	return nil
+}
+
+// zipArchiveWriter writes zip archives
+type zipArchiveWriter struct {
+	*zip.Writer
+	options ArchiveOptions
+}
+
+func (writer *zipArchiveWriter) WriteEntry(entry archiveEntry, content io.Reader) error {
+	header, err := zip.FileInfoHeader(entry.Info)
+	if err != nil {
+		return &ArchiveError{Path: entry.Path, Err: err}
+	}
+
+	header.Name = entry.Name
+	if entry.Info.IsDir() {
+		header.Name += "/"
+	} else {
+		header.Method = zip.Deflate
+	}
+
+	if writer.options.Reproducible {
+		header.Modified = ReproducibleModTime
+		header.Extra = nil
+		header.SetMode(entry.Info.Mode()&^os.ModePerm | reproducibleMode(entry.Info.Mode()))
+	}
+
+	w, err := writer.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	// Zip stores the target of a symlink as its content
+	if len(entry.Link) > 0 {
+		_, err = io.WriteString(w, entry.Link)
+		return err
+	}
+
+	if content != nil {
+		_, err = io.Copy(w, content)
+	}
+
+	return err
+}
+
+// archiveProgress gets called before a file gets archived
+type archiveProgress func(name string, done, total int)
+
+// folderArchive a folder prepared to be archived
+type folderArchive struct {
+	entries []archiveEntry
+	options ArchiveOptions
+	errs    *archiveErrors
+}
+
+// newFolderArchive collects the files of src which have to be archived.
+// onError gets called for each file skipped due to an error
+func newFolderArchive(src string, options ArchiveOptions, onError ArchiveErrorCallback) (*folderArchive, error) {
+	errs := &archiveErrors{callback: onError}
+
+	entries, err := collectArchiveEntries(src, options, errs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Inode layout, xattrs and holes are
+	// no part of a reproducible archive
+	if options.Reproducible {
+		options.Xattrs = false
+		options.Sparse = false
+	}
+
+	// Remember the first entry of each file to detect
+	// hardlinks. Zip can't store them
+	if options.GetFormat() != ArchiveZip && !options.Reproducible {
+		files := make(map[fileID]string)
+
+		for i, entry := range entries {
+			if !entry.Info.Mode().IsRegular() {
+				continue
+			}
+
+			if id, ok := getFileID(entry.Info); ok {
+				if name, exists := files[id]; exists {
+					entries[i].Hardlink = name
+				} else {
+					files[id] = entry.Name
+				}
+			}
+		}
+	}
+
+	return &folderArchive{
+		entries: entries,
+		options: options,
+		errs:    errs,
+	}, nil
+}
+
+// Size returns the exact size of the archive. The size of
+// compressed archives is unknown, so 0 is returned for them.
+// Entries failing here get skipped by WriteTo as well
+func (archive *folderArchive) Size() (int64, error) {
+	if archive.options.GetFormat() != ArchiveTar {
+		return 0, nil
+	}
+
+	var size int64
+	for _, entry := range archive.entries {
+		header, err := tarHeader(entry, archive.options)
+		if err != nil {
+			continue
+		}
+
+		if archive.options.Sparse && header.Typeflag == tar.TypeReg {
+			if err := archive.sparseHeader(entry, header); err != nil {
+				continue
+			}
+		}
+
+		encoded, err := encodeTarHeader(header)
+		if err != nil {
+			return 0, err
+		}
+
+		size += int64(len(encoded)) + header.Size + tarPadding(header.Size)
+	}
+
+	// Two empty blocks end the archive
+	return size + 2*tarBlockSize, nil
+}
+
+// sparseHeader converts header into a sparse header if entry has holes
+func (archive *folderArchive) sparseHeader(entry archiveEntry, header *tar.Header) error {
+	f, err := os.Open(entry.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	segments, err := sparseSegments(f, entry.Info)
+	if err != nil || segments == nil {
+		return err
+	}
+
+	sparseHeader(header, segments)
+	return nil
+}
+
+// WriteTo writes the archive into w
+func (archive *folderArchive) WriteTo(w io.Writer, progress archiveProgress) error {
+	writer, err := newArchiveWriter(archive.options, w)
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range archive.entries {
+		if progress != nil {
+			progress(entry.Name, i, len(archive.entries))
+		}
+
+		err := writeArchiveEntry(writer, entry)
+		if err == nil {
+			continue
+		}
+
+		// Skip files failing before anything got written
+		var archiveErr *ArchiveError
+		if !errors.As(err, &archiveErr) {
+			return err
+		}
+
+		if err := archive.errs.add(archiveErr); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// writeArchiveEntry writes a single entry including its content
+func writeArchiveEntry(writer archiveWriter, entry archiveEntry) error {
+	// Only regular files have content
+	if !entry.Info.Mode().IsRegular() || len(entry.Hardlink) > 0 {
+		return writer.WriteEntry(entry, nil)
+	}
+
+	f, err := os.Open(entry.Path)
+	if err != nil {
+		return &ArchiveError{Path: entry.Path, Err: err}
+	}
+	defer f.Close()
+
+	return writer.WriteEntry(entry, f)
+}
@@ -0,0 +1,435 @@
+package libdatamanager
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTestFiles creates the files in dir. Names
+// ending with a slash are created as directories
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if name[len(name)-1] == '/' {
+			if err := os.MkdirAll(file, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestFolder creates a folder containing files
+func newTestFolder(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", "dm-archive-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(root)
+	})
+
+	dir := filepath.Join(root, "folder")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFiles(t, dir, files)
+	return dir
+}
+
+// tarNames returns the sorted names of the entries of a tar archive
+func tarNames(t *testing.T, archive []byte) []string {
+	t.Helper()
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, header.Name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func TestFolderArchiveSkipsFiles(t *testing.T) {
+	files := map[string]string{
+		"a":     "a",
+		"dir/b": "b",
+		"dir/c": "c",
+	}
+
+	tests := []struct {
+		name      string
+		socket    bool
+		remove    []string
+		wantNames []string
+		wantSkip  int
+		wantErr   error
+	}{
+		{
+			name:      "socket",
+			socket:    true,
+			wantNames: []string{"folder/a", "folder/dir/", "folder/dir/b", "folder/dir/c"},
+		},
+		{
+			name:      "vanished file",
+			remove:    []string{"dir/b"},
+			wantNames: []string{"folder/a", "folder/dir/", "folder/dir/c"},
+			wantSkip:  1,
+		},
+		{
+			name:     "too many errors",
+			remove:   []string{"a", "dir/b", "dir/c"},
+			wantSkip: 3,
+			wantErr:  ErrTooManyArchiveErrors,
+		},
+	}
+
+	defer func(max int) {
+		MaxArchiveErrors = max
+	}(MaxArchiveErrors)
+	MaxArchiveErrors = 2
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := newTestFolder(t, files)
+
+			if test.socket {
+				listener, err := net.Listen("unix", filepath.Join(dir, "socket"))
+				if err != nil {
+					t.Skip("unix sockets not supported:", err)
+				}
+				defer listener.Close()
+			}
+
+			var skipped []*ArchiveError
+			archive, err := newFolderArchive(dir, ArchiveOptions{}, func(err *ArchiveError) {
+				skipped = append(skipped, err)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Let files vanish after collecting them
+			for _, name := range test.remove {
+				if err := os.Remove(filepath.Join(dir, name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var buf bytes.Buffer
+			err = archive.WriteTo(&buf, nil)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+
+			if len(skipped) != test.wantSkip {
+				t.Errorf("got %d skipped files %v, want %d", len(skipped), skipped, test.wantSkip)
+			}
+
+			if test.wantErr != nil {
+				return
+			}
+
+			names := tarNames(t, buf.Bytes())
+			if len(names) != len(test.wantNames) {
+				t.Fatalf("got entries %v, want %v", names, test.wantNames)
+			}
+
+			for i := range names {
+				if names[i] != test.wantNames[i] {
+					t.Fatalf("got entries %v, want %v", names, test.wantNames)
+				}
+			}
+		})
+	}
+}
+
+func TestFolderArchiveSkipsUnreadableFiles(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read every file")
+	}
+
+	dir := newTestFolder(t, map[string]string{
+		"a": "a",
+		"b": "b",
+	})
+
+	if err := os.Chmod(filepath.Join(dir, "b"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var skipped []*ArchiveError
+	archive, err := newFolderArchive(dir, ArchiveOptions{}, func(err *ArchiveError) {
+		skipped = append(skipped, err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(skipped) != 1 || skipped[0].Path != filepath.Join(dir, "b") {
+		t.Errorf("got skipped files %v, want b", skipped)
+	}
+
+	if len(archive.entries) != 1 || archive.entries[0].Name != "folder/a" {
+		t.Errorf("got %d entries, want folder/a only", len(archive.entries))
+	}
+}
+
+// addTestHoles makes file sparse by appending a hole and data
+func addTestHoles(t *testing.T, file string) {
+	t.Helper()
+
+	f, err := os.OpenFile(file, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteAt([]byte("end"), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestArchive archives dir into a buffer
+func writeTestArchive(t *testing.T, dir string, options ArchiveOptions) (*folderArchive, []byte) {
+	t.Helper()
+
+	archive, err := newFolderArchive(dir, options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := archive.WriteTo(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return archive, buf.Bytes()
+}
+
+func TestFolderArchiveSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		options ArchiveOptions
+	}{
+		{name: "default"},
+		{name: "reproducible", options: ArchiveOptions{Reproducible: true}},
+		{name: "sparse", options: ArchiveOptions{Sparse: true}},
+		{name: "xattrs", options: ArchiveOptions{Xattrs: true}},
+		{name: "reproducible sparse", options: ArchiveOptions{Reproducible: true, Sparse: true, Xattrs: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := newTestFolder(t, map[string]string{
+				"file":        "content",
+				"dir/":        "",
+				"dir/sparse":  "start",
+				"dir/another": "another",
+			})
+
+			addTestHoles(t, filepath.Join(dir, "dir", "sparse"))
+			if err := os.Link(filepath.Join(dir, "file"), filepath.Join(dir, "dir", "hardlink")); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink("file", filepath.Join(dir, "link")); err != nil {
+				t.Fatal(err)
+			}
+
+			archive, content := writeTestArchive(t, dir, test.options)
+
+			size, err := archive.Size()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if size != int64(len(content)) {
+				t.Errorf("got size %d, want %d", size, len(content))
+			}
+		})
+	}
+}
+
+func TestFolderArchiveReproducible(t *testing.T) {
+	files := map[string]string{
+		"file":     "content",
+		"exec":     "#!/bin/sh",
+		"dir/":     "",
+		"dir/copy": "content",
+		"dir/data": "data",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, dir string)
+	}{
+		{
+			name: "timestamps",
+			modify: func(t *testing.T, dir string) {
+				old := ReproducibleModTime.AddDate(5, 0, 0)
+				if err := os.Chtimes(filepath.Join(dir, "file"), old, old); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "permissions",
+			modify: func(t *testing.T, dir string) {
+				if err := os.Chmod(filepath.Join(dir, "file"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "hardlink",
+			modify: func(t *testing.T, dir string) {
+				copy := filepath.Join(dir, "dir", "copy")
+				if err := os.Remove(copy); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Link(filepath.Join(dir, "file"), copy); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "holes",
+			modify: func(t *testing.T, dir string) {
+				// Write the same content without holes
+				data := filepath.Join(dir, "dir", "data")
+				content, err := ioutil.ReadFile(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Remove(data); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(data, content, 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := ArchiveOptions{
+				Reproducible: true,
+				Sparse:       true,
+				Xattrs:       true,
+			}
+
+			dir := newTestFolder(t, files)
+			if err := os.Chmod(filepath.Join(dir, "exec"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			addTestHoles(t, filepath.Join(dir, "dir", "data"))
+
+			_, want := writeTestArchive(t, dir, options)
+			test.modify(t, dir)
+
+			if _, got := writeTestArchive(t, dir, options); !bytes.Equal(got, want) {
+				t.Error("archive changed")
+			}
+		})
+	}
+}
+
+func TestCollectArchiveEntries(t *testing.T) {
+	files := map[string]string{
+		".gitignore":    "*.log\n",
+		"a.txt":         "a",
+		"b.go":          "package b",
+		"debug.log":     "log",
+		"big.bin":       "0123456789",
+		"sub/c.txt":     "c",
+		"sub/d.go":      "package d",
+		"vendor/e.go":   "package e",
+		"vendor/f.txt":  "f",
+		"empty/":        "",
+		"sub/trace.log": "log",
+	}
+
+	tests := []struct {
+		name    string
+		options ArchiveOptions
+		want    []string
+	}{
+		{
+			name: "ignore files",
+			want: []string{".gitignore", "a.txt", "b.go", "big.bin", "empty", "sub", "sub/c.txt", "sub/d.go", "vendor", "vendor/e.go", "vendor/f.txt"},
+		},
+		{
+			name:    "ignore files disabled",
+			options: ArchiveOptions{DisableIgnoreFiles: true},
+			want:    []string{".gitignore", "a.txt", "b.go", "big.bin", "debug.log", "empty", "sub", "sub/c.txt", "sub/d.go", "sub/trace.log", "vendor", "vendor/e.go", "vendor/f.txt"},
+		},
+		{
+			name:    "include",
+			options: ArchiveOptions{Include: []string{"*.go"}},
+			want:    []string{"b.go", "empty", "sub", "sub/d.go", "vendor", "vendor/e.go"},
+		},
+		{
+			name:    "exclude dir",
+			options: ArchiveOptions{Exclude: []string{"vendor/", "/*.txt"}},
+			want:    []string{".gitignore", "b.go", "big.bin", "empty", "sub", "sub/c.txt", "sub/d.go"},
+		},
+		{
+			name:    "max file size",
+			options: ArchiveOptions{MaxFileSize: 9, Include: []string{"*.bin", "*.txt"}},
+			want:    []string{"a.txt", "empty", "sub", "sub/c.txt", "vendor", "vendor/f.txt"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := newTestFolder(t, files)
+
+			test.options.Reproducible = true
+			entries, err := collectArchiveEntries(dir, test.options, &archiveErrors{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, entry := range entries {
+				names = append(names, strings.TrimPrefix(entry.Name, "folder/"))
+			}
+
+			if strings.Join(names, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got entries %v, want %v", names, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package libdatamanager
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultBatchSize the default count of operations sent in one request
+const DefaultBatchSize = 100
+
+var (
+	// ErrNoBatchResult error if the server returned no result for an operation
+	ErrNoBatchResult = errors.New("no result for operation")
+)
+
+// BatchAction action of a batch operation
+type BatchAction string
+
+// Batch actions
+const (
+	BatchActionUpdate BatchAction = "update"
+	BatchActionDelete BatchAction = "delete"
+)
+
+// BatchOperation a single operation on a file
+type BatchOperation struct {
+	FileID    uint           `json:"fid"`
+	Action    BatchAction    `json:"action"`
+	Updates   FileUpdateItem `json:"updates,omitempty"`
+	Permanent bool           `json:"permanent,omitempty"`
+}
+
+// FileBatch a list of operations on files
+type FileBatch struct {
+	LibDM
+	Operations []BatchOperation
+	BatchSize  int
+}
+
+// BatchItemResult result of a single operation. Err is nil on success
+type BatchItemResult struct {
+	Operation BatchOperation
+	Err       error
+}
+
+// BatchReport the results of all operations of a batch
+type BatchReport struct {
+	Results []BatchItemResult
+}
+
+// NewBatch create a new batch of file operations
+func (libdm LibDM) NewBatch() *FileBatch {
+	return &FileBatch{
+		LibDM:     libdm,
+		BatchSize: DefaultBatchSize,
+	}
+}
+
+// Add adds an operation to the batch
+func (batch *FileBatch) Add(op BatchOperation) *FileBatch {
+	batch.Operations = append(batch.Operations, op)
+	return batch
+}
+
+// Update applies changes to the file
+func (batch *FileBatch) Update(fileID uint, changes FileChanges) *FileBatch {
+	return batch.Add(BatchOperation{
+		FileID:  fileID,
+		Action:  BatchActionUpdate,
+		Updates: changes.ToUpdateItem(),
+	})
+}
+
+// Rename renames the file
+func (batch *FileBatch) Rename(fileID uint, newName string) *FileBatch {
+	return batch.Update(fileID, FileChanges{NewName: newName})
+}
+
+// Move moves the file into namespace
+func (batch *FileBatch) Move(fileID uint, namespace string) *FileBatch {
+	return batch.Update(fileID, FileChanges{NewNamespace: namespace})
+}
+
+// AddTags adds tags to the file
+func (batch *FileBatch) AddTags(fileID uint, tags ...string) *FileBatch {
+	return batch.Update(fileID, FileChanges{AddTags: tags})
+}
+
+// RemoveTags removes tags from the file
+func (batch *FileBatch) RemoveTags(fileID uint, tags ...string) *FileBatch {
+	return batch.Update(fileID, FileChanges{RemoveTags: tags})
+}
+
+// AddGroups adds the file to groups
+func (batch *FileBatch) AddGroups(fileID uint, groups ...string) *FileBatch {
+	return batch.Update(fileID, FileChanges{AddGroups: groups})
+}
+
+// RemoveGroups removes the file from groups
+func (batch *FileBatch) RemoveGroups(fileID uint, groups ...string) *FileBatch {
+	return batch.Update(fileID, FileChanges{RemoveGroups: groups})
+}
+
+// Delete moves the file into the trash
+func (batch *FileBatch) Delete(fileID uint) *FileBatch {
+	return batch.Add(BatchOperation{
+		FileID: fileID,
+		Action: BatchActionDelete,
+	})
+}
+
+// DeletePermanent deletes the file without using the trash
+func (batch *FileBatch) DeletePermanent(fileID uint) *FileBatch {
+	return batch.Add(BatchOperation{
+		FileID:    fileID,
+		Action:    BatchActionDelete,
+		Permanent: true,
+	})
+}
+
+// Do sends all operations in chunks of BatchSize. Errors of single
+// operations or chunks are reported in the returned BatchReport
+func (batch *FileBatch) Do() *BatchReport {
+	size := batch.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+
+	report := &BatchReport{
+		Results: make([]BatchItemResult, len(batch.Operations)),
+	}
+
+	for start := 0; start < len(batch.Operations); start += size {
+		end := start + size
+		if end > len(batch.Operations) {
+			end = len(batch.Operations)
+		}
+
+		batch.doChunk(start, batch.Operations[start:end], report)
+	}
+
+	return report
+}
+
+// doChunk sends ops and writes the results into report
+func (batch *FileBatch) doChunk(offset int, ops []BatchOperation, report *BatchReport) {
+	errs := make([]error, len(ops))
+	for i := range errs {
+		errs[i] = ErrNoBatchResult
+	}
+
+	var response BatchResponse
+	if _, err := batch.Request(EPFileBatch, &BatchRequest{
+		Operations: ops,
+	}, &response, true); err != nil {
+		// The whole chunk failed
+		for i := range errs {
+			errs[i] = err
+		}
+	} else {
+		for _, result := range response.Results {
+			if result.Index < 0 || result.Index >= len(ops) {
+				continue
+			}
+
+			errs[result.Index] = nil
+			if len(result.Error) > 0 {
+				errs[result.Index] = errors.New(result.Error)
+			}
+		}
+	}
+
+	for i := range ops {
+		report.Results[offset+i] = BatchItemResult{
+			Operation: ops[i],
+			Err:       errs[i],
+		}
+	}
+}
+
+// Failed returns the results of all failed operations
+func (report *BatchReport) Failed() []BatchItemResult {
+	var failed []BatchItemResult
+	for _, result := range report.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+
+	return failed
+}
+
+// Succeeded returns true if all operations were successful
+func (report *BatchReport) Succeeded() bool {
+	return len(report.Failed()) == 0
+}
+
+// Err returns an error summarizing all failed operations or nil
+func (report *BatchReport) Err() error {
+	failed := report.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%d of %d operations failed. First error: %s (file %d)",
+		len(failed), len(report.Results), failed[0].Err, failed[0].Operation.FileID)
+}
+
+// Retry returns a new batch containing all failed operations
+func (report *BatchReport) Retry(libdm LibDM) *FileBatch {
+	batch := libdm.NewBatch()
+	for _, result := range report.Failed() {
+		batch.Add(result.Operation)
+	}
+
+	return batch
+}
@@ -0,0 +1,118 @@
+package libdatamanager
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// newTestBatchServer answers batch requests. Operations on odd file IDs
+// fail, file IDs >= 100 get no result and chunks containing file 0 fail
+func newTestBatchServer(t *testing.T) (LibDM, *int) {
+	t.Helper()
+
+	var requests int
+	libdm := newTestServer(t, map[Endpoint]interface{}{
+		EPFileBatch: testHandler(func(r *http.Request) interface{} {
+			requests++
+
+			var request BatchRequest
+			json.NewDecoder(r.Body).Decode(&request)
+
+			// Answer in reverse order
+			var response BatchResponse
+			for i := len(request.Operations) - 1; i >= 0; i-- {
+				op := request.Operations[i]
+
+				switch {
+				case op.FileID == 0:
+					return testStatus{code: http.StatusInternalServerError}
+				case op.FileID >= 100:
+					continue
+				case op.FileID%2 == 1:
+					response.Results = append(response.Results, BatchResultItem{Index: i, Error: "failed"})
+				default:
+					response.Results = append(response.Results, BatchResultItem{Index: i})
+				}
+			}
+
+			// Invalid indexes are ignored
+			response.Results = append(response.Results, BatchResultItem{Index: len(request.Operations)}, BatchResultItem{Index: -1})
+			return response
+		}),
+	})
+
+	return *libdm, &requests
+}
+
+func TestBatchResults(t *testing.T) {
+	tests := []struct {
+		name         string
+		fileIDs      []uint
+		batchSize    int
+		wantFailed   []uint
+		wantRequests int
+	}{
+		{name: "all succeeded", fileIDs: []uint{2, 4, 6}, wantRequests: 1},
+		{name: "mapped by index", fileIDs: []uint{2, 3, 4, 5}, wantFailed: []uint{3, 5}, wantRequests: 1},
+		{name: "missing results", fileIDs: []uint{2, 100, 4}, wantFailed: []uint{100}, wantRequests: 1},
+		{name: "chunks", fileIDs: []uint{1, 2, 3, 4, 5}, batchSize: 2, wantFailed: []uint{1, 3, 5}, wantRequests: 3},
+		{name: "failed chunk", fileIDs: []uint{2, 0, 4, 6}, batchSize: 2, wantFailed: []uint{2, 0}, wantRequests: 2},
+		{name: "empty", wantRequests: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			libdm, requests := newTestBatchServer(t)
+
+			batch := libdm.NewBatch()
+			if test.batchSize > 0 {
+				batch.BatchSize = test.batchSize
+			}
+
+			for _, id := range test.fileIDs {
+				batch.Rename(id, "name")
+			}
+
+			report := batch.Do()
+			if *requests != test.wantRequests {
+				t.Errorf("got %d requests, want %d", *requests, test.wantRequests)
+			}
+
+			if len(report.Results) != len(test.fileIDs) {
+				t.Fatalf("got %d results, want %d", len(report.Results), len(test.fileIDs))
+			}
+
+			for i, result := range report.Results {
+				if result.Operation.FileID != test.fileIDs[i] {
+					t.Errorf("result %d belongs to file %d, want %d", i, result.Operation.FileID, test.fileIDs[i])
+				}
+			}
+
+			failed := report.Failed()
+			if len(failed) != len(test.wantFailed) {
+				t.Fatalf("got %d failed operations, want %v", len(failed), test.wantFailed)
+			}
+
+			for i, result := range failed {
+				if result.Operation.FileID != test.wantFailed[i] {
+					t.Errorf("got failed file %d, want %d", result.Operation.FileID, test.wantFailed[i])
+				}
+
+				if result.Operation.FileID >= 100 && !errors.Is(result.Err, ErrNoBatchResult) {
+					t.Errorf("got error %v for missing result, want ErrNoBatchResult", result.Err)
+				}
+			}
+
+			if report.Succeeded() != (len(test.wantFailed) == 0) || (report.Err() == nil) != report.Succeeded() {
+				t.Errorf("got succeeded %v (%v), want %v", report.Succeeded(), report.Err(), len(test.wantFailed) == 0)
+			}
+
+			retry := report.Retry(libdm)
+			if len(retry.Operations) != len(test.wantFailed) {
+				t.Errorf("got %d operations to retry, want %d", len(retry.Operations), len(test.wantFailed))
+			}
+		})
+	}
+}
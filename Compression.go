@@ -0,0 +1,203 @@
+package libdatamanager
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	gzip "github.com/klauspost/pgzip"
+)
+
+// PipelineOrder order in which compression and encryption were
+// applied to a stored file. Files uploaded before the order was
+// recorded were encrypted first and compressed afterwards
+type PipelineOrder string
+
+// Pipeline orders
+const (
+	OrderNone            PipelineOrder = ""
+	OrderCompressEncrypt PipelineOrder = "compress,encrypt"
+)
+
+// Compression compression algorithm of stored files
+type Compression string
+
+// Compression algorithms
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// compressionNoneName is stored instead of CompressionNone. Files
+// uploaded before the algorithm was recorded have no compression
+// value, but are gzip compressed if they are compressed at all
+const compressionNoneName Compression = "none"
+
+// storedName returns the value of c stored by the server
+func (c Compression) storedName() Compression {
+	if c == CompressionNone {
+		return compressionNoneName
+	}
+
+	return c
+}
+
+// parseStoredCompression parses the compression of a downloaded file.
+// legacy is true for files without compression and pipeline header
+func parseStoredCompression(header string, pipeline PipelineOrder) (compression Compression, legacy bool) {
+	switch Compression(header) {
+	case compressionNoneName:
+		return CompressionNone, false
+	case CompressionNone:
+		return CompressionNone, pipeline == OrderNone
+	}
+
+	return Compression(header), false
+}
+
+const (
+	// compressionSampleSize bytes used to detect incompressible content
+	compressionSampleSize = 64 * 1024
+
+	// maxCompressibleEntropy max entropy in bits per byte
+	// of a sample still worth compressing
+	maxCompressibleEntropy = 7.5
+)
+
+// Mime types which are compressed already
+var incompressibleMimePrefixes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"video/",
+	"audio/",
+	"application/zip",
+	"application/x-gzip",
+	"application/x-rar-compressed",
+	"application/x-7z-compressed",
+	"application/pdf",
+	"font/woff",
+}
+
+// IsValidCompression returns true if c is a supported compression
+func IsValidCompression(c Compression) bool {
+	switch c {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return true
+	}
+
+	return false
+}
+
+// newCompressWriter returns a writer compressing into w. Level 0 uses
+// the default level of the algorithm
+func newCompressWriter(c Compression, level int, w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+
+		return gzip.NewWriterLevel(w, level)
+	case CompressionZstd:
+		if level == 0 {
+			return zstd.NewWriter(w)
+		}
+
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	}
+
+	return nil, ErrCompressionNotSupported
+}
+
+// compressReader returns a reader providing the compressed content of r.
+// Closing it stops the compression
+func compressReader(c Compression, level int, r io.Reader) io.ReadCloser {
+	pR, pW := io.Pipe()
+
+	go func() {
+		compressor, err := newCompressWriter(c, level, pW)
+		if err == nil {
+			_, err = io.Copy(compressor, r)
+			if cerr := compressor.Close(); err == nil {
+				err = cerr
+			}
+		}
+
+		pW.CloseWithError(err)
+	}()
+
+	return pR
+}
+
+// newDecompressReader returns a reader decompressing r
+func newDecompressReader(c Compression, r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return dec.IOReadCloser(), nil
+	}
+
+	return nil, ErrCompressionNotSupported
+}
+
+// IsIncompressible returns true if sample looks like compressed or
+// random data, based on its mime type and its entropy
+func IsIncompressible(sample []byte) bool {
+	if len(sample) == 0 {
+		return false
+	}
+
+	mime := http.DetectContentType(sample)
+	for _, prefix := range incompressibleMimePrefixes {
+		if strings.HasPrefix(mime, prefix) {
+			return true
+		}
+	}
+
+	return sampleEntropy(sample) > maxCompressibleEntropy
+}
+
+// sampleEntropy returns the shannon entropy in bits per byte
+func sampleEntropy(sample []byte) float64 {
+	var counts [256]int
+	for _, b := range sample {
+		counts[b]++
+	}
+
+	var entropy float64
+	size := float64(len(sample))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+
+		p := float64(c) / size
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
+
+// peekSample returns a reader replacing r and the first bytes of r
+func peekSample(r io.Reader) (io.Reader, []byte, error) {
+	buffered := bufio.NewReaderSize(r, compressionSampleSize)
+
+	sample, err := buffered.Peek(compressionSampleSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, nil, err
+	}
+
+	return buffered, sample, nil
+}
@@ -0,0 +1,158 @@
+package libdatamanager
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseStoredCompression(t *testing.T) {
+	tests := []struct {
+		header     string
+		pipeline   PipelineOrder
+		want       Compression
+		wantLegacy bool
+	}{
+		{"", OrderNone, CompressionNone, true},
+		{"none", OrderNone, CompressionNone, false},
+		{"gzip", OrderNone, CompressionGzip, false},
+		{"zstd", OrderCompressEncrypt, CompressionZstd, false},
+		{"", OrderCompressEncrypt, CompressionNone, false},
+	}
+
+	for _, test := range tests {
+		compression, legacy := parseStoredCompression(test.header, test.pipeline)
+		if compression != test.want || legacy != test.wantLegacy {
+			t.Errorf("%q, %q: got %q (legacy %v), want %q (legacy %v)",
+				test.header, test.pipeline, compression, legacy, test.want, test.wantLegacy)
+		}
+	}
+}
+
+// decompressTestContent returns the decompressed content
+func decompressTestContent(t *testing.T, compression Compression, content []byte) []byte {
+	t.Helper()
+
+	r, err := newDecompressReader(compression, bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	decompressed, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return decompressed
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	content := make([]byte, 200000)
+	rand.New(rand.NewSource(1)).Read(content[:50000])
+
+	for _, encryption := range []int8{0, 1, 2} {
+		for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+			for _, extract := range []bool{false, true} {
+				fake, libdm := newFakeFileServer(t)
+
+				var key []byte
+				request := libdm.NewUploadRequest("file", FileAttributes{}).CompressWith(compression, 0)
+				if encryption > 0 {
+					key, _ = GenerateKey(encryption)
+					request.Encrypted(encryption, key)
+				}
+
+				resp, err := request.UploadFromReader(bytes.NewReader(content), int64(len(content)), make(chan string, 1), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if stored := fake.files[resp.FileID].request.Compression; stored != compression.storedName() {
+					t.Errorf("%d/%q: stored compression %q", encryption, compression, stored)
+				}
+
+				downloadRequest := libdm.NewFileRequestByID(resp.FileID).DecryptWith(key)
+				if !extract {
+					downloadRequest.NoDecompress()
+				}
+
+				download, err := downloadRequest.Do()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var out bytes.Buffer
+				if err := download.SaveTo(&out, nil); err != nil {
+					t.Errorf("%d/%q/%v: %v", encryption, compression, extract, err)
+					continue
+				}
+
+				// Kept compressed content must be decompressable
+				got := out.Bytes()
+				if compression != CompressionNone && !extract {
+					if bytes.Equal(got, content) {
+						t.Errorf("%d/%q: content decompressed", encryption, compression)
+					}
+
+					got = decompressTestContent(t, compression, got)
+				}
+
+				if !bytes.Equal(got, content) {
+					t.Errorf("%d/%q/%v: downloaded content differs", encryption, compression, extract)
+				}
+			}
+		}
+	}
+}
+
+func TestDownloadToFileDecompresses(t *testing.T) {
+	content := bytes.Repeat([]byte("compressible content "), 10000)
+
+	tests := []struct {
+		encryption  int8
+		compression Compression
+	}{
+		{1, CompressionGzip},
+		{1, CompressionZstd},
+		{2, CompressionGzip},
+		{2, CompressionZstd},
+	}
+
+	for _, test := range tests {
+		fake, libdm := newFakeFileServer(t)
+
+		key, _ := GenerateKey(test.encryption)
+		resp, err := libdm.NewUploadRequest("file.txt", FileAttributes{}).
+			CompressWith(test.compression, 0).
+			Encrypted(test.encryption, key).
+			UploadFromReader(bytes.NewReader(content), int64(len(content)), make(chan string, 1), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fake.mx.Lock()
+		stored := len(fake.files[resp.FileID].content)
+		fake.mx.Unlock()
+
+		if stored >= len(content) {
+			t.Errorf("%d/%q: stored %d bytes, want compressed content", test.encryption, test.compression, stored)
+		}
+
+		dir := newTestFolder(t, nil)
+		if _, err := libdm.NewFileRequestByID(resp.FileID).DecryptWith(key).DownloadToFile(dir, 0600, true); err != nil {
+			t.Fatalf("%d/%q: %v", test.encryption, test.compression, err)
+		}
+
+		downloaded, err := ioutil.ReadFile(filepath.Join(dir, "file.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(downloaded, content) {
+			t.Errorf("%d/%q: downloaded %d bytes, want the original content", test.encryption, test.compression, len(downloaded))
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"strings"
@@ -57,6 +58,30 @@ func IsValidCipher(c string) bool {
 	return false
 }
 
+// GenerateKey generates a new random key for the given encryption method
+func GenerateKey(encryption int8) ([]byte, error) {
+	switch encryption {
+	case 1:
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	case 2:
+		id, err := age.GenerateX25519Identity()
+		if err != nil {
+			return nil, err
+		}
+
+		// Use the format of age-keygen to allow
+		// extracting the public key later on
+		return []byte(fmt.Sprintf("# public key: %s\n%s\n", id.Recipient(), id)), nil
+	}
+
+	return nil, ErrCipherNotSupported
+}
+
 // Extract public key from private key file
 func getPubKeyFromIdentity(b []byte) io.Reader {
 	scanner := bufio.NewScanner(bytes.NewBuffer(b))
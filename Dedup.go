@@ -0,0 +1,161 @@
+package libdatamanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+)
+
+// DedupMode how to handle uploads of already existing content
+type DedupMode uint8
+
+// Dedup modes
+const (
+	// DedupNone always upload the content
+	DedupNone DedupMode = iota
+
+	// DedupReturnExisting return the existing file
+	// instead of creating a new one
+	DedupReturnExisting
+
+	// DedupLink create a new file using the
+	// content of the existing file
+	DedupLink
+)
+
+// Deduplicate skip uploading content which already exists in the namespace.
+// The content hash is calculated before uploading if the source is seekable.
+// Otherwise contentHash (see HashContent) has to be passed. Encrypted uploads
+// require a keystore, which keys the hash so the server can't confirm the
+// content. They are only deduplicated against files with a key in the keystore
+func (uploadRequest *UploadRequest) Deduplicate(mode DedupMode, contentHash ...string) *UploadRequest {
+	uploadRequest.Dedup = mode
+	if len(contentHash) > 0 {
+		uploadRequest.ContentHash = contentHash[0]
+	}
+
+	return uploadRequest
+}
+
+// HashContent returns the content hash used for deduplication
+func HashContent(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// dedupEnabled returns true if the upload should be deduplicated
+func (uploadRequest *UploadRequest) dedupEnabled() bool {
+	return uploadRequest.Dedup != DedupNone && uploadRequest.ReplaceFileID == 0
+}
+
+// resolveContentHash sets the hash sent to the server for the current
+// upload. ContentHash is never changed, so the request can be reused
+func (uploadRequest *UploadRequest) resolveContentHash(r io.Reader) error {
+	uploadRequest.contentHash = ""
+
+	hash := uploadRequest.ContentHash
+
+	// Hash seekable sources
+	if len(hash) == 0 && uploadRequest.dedupEnabled() {
+		seeker, ok := r.(io.ReadSeeker)
+		if !ok {
+			return nil
+		}
+
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil
+		}
+
+		if hash, err = HashContent(seeker); err != nil {
+			return err
+		}
+
+		if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	if len(hash) == 0 {
+		return nil
+	}
+
+	// The plain hash would reveal the content of encrypted files
+	if uploadRequest.Encryption != 0 {
+		keystore := uploadRequest.getKeystore()
+		if keystore == nil {
+			return nil
+		}
+
+		var err error
+		if hash, err = keystore.DedupHash(hash); err != nil {
+			return err
+		}
+	}
+
+	uploadRequest.contentHash = hash
+	return nil
+}
+
+// deduplicate returns the response of an existing file with the same
+// content as r or nil if r has to be uploaded
+func (uploadRequest *UploadRequest) deduplicate(r io.Reader) (*UploadResponse, error) {
+	if err := uploadRequest.resolveContentHash(r); err != nil {
+		return nil, err
+	}
+
+	if !uploadRequest.dedupEnabled() || len(uploadRequest.contentHash) == 0 {
+		return nil, nil
+	}
+
+	// Ask the server
+	var exists FileExistsResponse
+	if _, err := uploadRequest.Request(EPFileExists, &FileExistsRequest{
+		ContentHash: uploadRequest.contentHash,
+		Namespace:   uploadRequest.Attribute.Namespace,
+		Encryption:  uploadRequest.Encryption,
+	}, &exists, true); err != nil || !exists.Exists {
+		return nil, err
+	}
+
+	// The ciphertext of the existing file can
+	// only be used with its key
+	keystore := uploadRequest.getKeystore()
+	if uploadRequest.Encryption != 0 {
+		if keystore == nil {
+			return nil, nil
+		}
+
+		if _, err := keystore.GetKey(exists.File.FileID); err != nil {
+			return nil, nil
+		}
+	}
+
+	if uploadRequest.Dedup == DedupReturnExisting {
+		exists.File.Deduplicated = true
+		return &exists.File, nil
+	}
+
+	// Create new file from existing content
+	var resp UploadResponse
+	if _, err := uploadRequest.Request(EPFileLink, &FileLinkRequest{
+		SourceID: exists.File.FileID,
+		Upload:   *uploadRequest.BuildRequestStruct(FileUploadType),
+	}, &resp, true); err != nil {
+		return nil, err
+	}
+	resp.Deduplicated = true
+
+	// Use the same key for the new file
+	if uploadRequest.Encryption != 0 {
+		if err := keystore.CopyKey(exists.File.FileID, resp.FileID); err != nil {
+			return &resp, err
+		}
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,109 @@
+package libdatamanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDeduplicateContentHash(t *testing.T) {
+	var hashes []string
+	libdm := newTestServer(t, map[Endpoint]interface{}{
+		EPFileExists: testHandler(func(r *http.Request) interface{} {
+			var request FileExistsRequest
+			json.NewDecoder(r.Body).Decode(&request)
+			hashes = append(hashes, request.ContentHash)
+
+			return FileExistsResponse{}
+		}),
+	})
+
+	plainHash, err := HashContent(strings.NewReader("content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newTestKeystore(t)
+	keyedHash, err := store.WithRequestConfig(libdm.Config).DedupHash(plainHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyedHash == plainHash {
+		t.Fatal("keyed hash equals the plain hash")
+	}
+
+	tests := []struct {
+		name       string
+		encryption int8
+		keystore   *Keystore
+		hash       string
+		want       string
+	}{
+		{name: "plain", want: plainHash},
+		{name: "plain with given hash", hash: "given", want: "given"},
+		{name: "encrypted", encryption: 1, keystore: store, want: keyedHash},
+		{name: "encrypted with given hash", encryption: 1, keystore: store, hash: plainHash, want: keyedHash},
+		{name: "encrypted without keystore", encryption: 1},
+	}
+
+	for _, test := range tests {
+		hashes = nil
+
+		client := *libdm
+		client.Keystore = test.keystore
+
+		request := client.NewUploadRequest("file", FileAttributes{}).Deduplicate(DedupReturnExisting, test.hash)
+		request.Encryption = test.encryption
+
+		resp, err := request.deduplicate(strings.NewReader("content"))
+		if err != nil || resp != nil {
+			t.Errorf("%s: got %v (%v), want no existing file", test.name, resp, err)
+			continue
+		}
+
+		if len(test.want) == 0 {
+			if len(hashes) > 0 || len(request.contentHash) > 0 {
+				t.Errorf("%s: hash %q sent to the server", test.name, hashes)
+			}
+			continue
+		}
+
+		if len(hashes) != 1 || hashes[0] != test.want {
+			t.Errorf("%s: got hashes %q, want %q", test.name, hashes, test.want)
+		}
+
+		if request.ContentHash != test.hash {
+			t.Errorf("%s: ContentHash changed to %q", test.name, request.ContentHash)
+		}
+
+		if built := request.BuildRequestStruct(FileUploadType).ContentHash; built != test.want {
+			t.Errorf("%s: got hash %q in upload request, want %q", test.name, built, test.want)
+		}
+	}
+}
+
+func TestDeduplicateReusedRequest(t *testing.T) {
+	var hashes []string
+	libdm := newTestServer(t, map[Endpoint]interface{}{
+		EPFileExists: testHandler(func(r *http.Request) interface{} {
+			var request FileExistsRequest
+			json.NewDecoder(r.Body).Decode(&request)
+			hashes = append(hashes, request.ContentHash)
+
+			return FileExistsResponse{}
+		}),
+	})
+
+	request := libdm.NewUploadRequest("file", FileAttributes{}).Deduplicate(DedupLink)
+	for _, content := range []string{"first", "second"} {
+		if _, err := request.deduplicate(strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(hashes) != 2 || hashes[0] == hashes[1] {
+		t.Errorf("got hashes %q, want two different ones", hashes)
+	}
+}
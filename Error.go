@@ -3,6 +3,8 @@ package libdatamanager
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 )
 
 var (
@@ -31,6 +33,46 @@ func (reserr *ResponseErr) Error() string {
 	return "Unexpected error"
 }
 
+// KeyMissingError error if the key of an encrypted
+// file couldn't be found in the keystore
+type KeyMissingError struct {
+	FileID    uint
+	ServerURL string
+	Username  string
+	Err       error
+}
+
+func (kerr *KeyMissingError) Error() string {
+	msg := fmt.Sprintf("no key for file %d of %s@%s in keystore", kerr.FileID, kerr.Username, kerr.ServerURL)
+	if kerr.Err != nil {
+		msg += ": " + kerr.Err.Error()
+	}
+
+	return msg
+}
+
+// Unwrap returns the underlying error
+func (kerr *KeyMissingError) Unwrap() error {
+	return kerr.Err
+}
+
+// isTemporaryError returns true if a request failed due to a connection
+// error, a server error or rate limiting and may succeed if retried
+func isTemporaryError(err error) bool {
+	var resErr *ResponseErr
+	if !errors.As(err, &resErr) {
+		return false
+	}
+
+	if resErr.Response == nil {
+		var netErr net.Error
+		return errors.As(resErr.Err, &netErr)
+	}
+
+	code := resErr.Response.HTTPCode
+	return code >= 500 || code == http.StatusTooManyRequests
+}
+
 // NewErrorFromResponse return error from response
 func NewErrorFromResponse(r *RestRequestResponse, err ...error) *ResponseErr {
 	var (
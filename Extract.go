@@ -0,0 +1,424 @@
+package libdatamanager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidArchivePath if an archive entry would be extracted outside the destination
+	ErrInvalidArchivePath = errors.New("archive entry outside of destination")
+)
+
+// ExtractOptions options for extracting archives. Owners are only
+// restored if the process is allowed to change them. Sparse creates
+// holes instead of writing zero blocks of regular files
+type ExtractOptions struct {
+	Format ArchiveFormat
+	Xattrs bool
+	Owners bool
+	Sparse bool
+}
+
+// GetFormat returns the archive format, tar if not set
+func (options ExtractOptions) GetFormat() ArchiveFormat {
+	if len(options.Format) == 0 {
+		return ArchiveTar
+	}
+
+	return options.Format
+}
+
+// ExtractArchive extracts the archive read from r into the directory dest
+func ExtractArchive(r io.Reader, dest string, options ExtractOptions) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	extractor := &archiveExtractor{
+		dest:    filepath.Clean(dest),
+		options: options,
+	}
+
+	switch format := options.GetFormat(); format {
+	case ArchiveTar:
+		return extractor.extractTar(r)
+	case ArchiveTarGzip, ArchiveTarZstd:
+		compression := CompressionGzip
+		if format == ArchiveTarZstd {
+			compression = CompressionZstd
+		}
+
+		decompressor, err := newDecompressReader(compression, r)
+		if err != nil {
+			return err
+		}
+		defer decompressor.Close()
+
+		return extractor.extractTar(decompressor)
+	case ArchiveZip:
+		return extractor.extractZip(r)
+	}
+
+	return ErrArchiveFormatNotSupported
+}
+
+// ExtractTo downloads an archived file and extracts it into dest
+func (fileresponse *FileDownloadResponse) ExtractTo(dest string, options ExtractOptions, cancelChan chan bool) error {
+	pR, pW := io.Pipe()
+
+	go func() {
+		pW.CloseWithError(fileresponse.SaveTo(pW, cancelChan))
+	}()
+
+	err := ExtractArchive(pR, dest, options)
+	pR.CloseWithError(err)
+	return err
+}
+
+// archiveExtractor extracts archives into dest
+type archiveExtractor struct {
+	dest    string
+	options ExtractOptions
+	dirs    []extractedDir
+}
+
+// extractedDir a dir whose attributes get restored after
+// its content. id identifies the dir which was created
+type extractedDir struct {
+	header *tar.Header
+	id     fileID
+	hasID  bool
+}
+
+// target returns the path of an extracted entry and makes sure it's
+// inside dest, even if parent dirs or the entry itself are symlinks
+func (extractor *archiveExtractor) target(name string) (string, error) {
+	target := filepath.Join(extractor.dest, filepath.FromSlash(name))
+	if !isInsideDir(extractor.dest, target) {
+		return "", ErrInvalidArchivePath
+	}
+
+	parent := filepath.Dir(target)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+
+	// Extracted symlinks must not redirect later entries
+	resolvedDest, err := filepath.EvalSymlinks(extractor.dest)
+	if err != nil {
+		return "", err
+	}
+
+	resolvedParent, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return "", err
+	}
+
+	if !isInsideDir(resolvedDest, resolvedParent) {
+		return "", ErrInvalidArchivePath
+	}
+
+	// An existing symlink must not point outside either
+	if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		resolved, err := filepath.EvalSymlinks(target)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+
+		if err == nil && !isInsideDir(resolvedDest, resolved) {
+			return "", ErrInvalidArchivePath
+		}
+	}
+
+	return target, nil
+}
+
+// isInsideDir returns true if file is dir or inside of it
+func isInsideDir(dir, file string) bool {
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// extractTar extracts a tar stream
+func (extractor *archiveExtractor) extractTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := extractor.extractTarEntry(header, tr); err != nil {
+			return err
+		}
+	}
+
+	return extractor.restoreDirs()
+}
+
+// restoreDirs sets the attributes of the extracted dirs. This
+// has to happen after their content was written
+func (extractor *archiveExtractor) restoreDirs() error {
+	for i := len(extractor.dirs) - 1; i >= 0; i-- {
+		dir := extractor.dirs[i]
+
+		target, err := extractor.target(dir.header.Name)
+		if err != nil {
+			return err
+		}
+
+		// Skip dirs which were replaced by later entries
+		fi, err := os.Lstat(target)
+		if err != nil || !fi.IsDir() {
+			continue
+		}
+
+		if id, ok := getFileID(fi); dir.hasID && (!ok || id != dir.id) {
+			continue
+		}
+
+		if err := extractor.restoreAttributes(target, dir.header); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractTarEntry extracts a single entry of a tar archive
+func (extractor *archiveExtractor) extractTarEntry(header *tar.Header, content io.Reader) error {
+	target, err := extractor.target(header.Name)
+	if err != nil {
+		return err
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		// Never create dirs through an existing symlink
+		if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+
+		if err := os.MkdirAll(target, 0700); err != nil {
+			return err
+		}
+
+		fi, err := os.Lstat(target)
+		if err != nil {
+			return err
+		}
+
+		dir := extractedDir{header: header}
+		dir.id, dir.hasID = getFileID(fi)
+		extractor.dirs = append(extractor.dirs, dir)
+		return nil
+	case tar.TypeReg, tar.TypeRegA:
+		if err := extractor.writeFile(target, content); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		os.Remove(target)
+		if err := os.Symlink(header.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		source, err := extractor.target(header.Linkname)
+		if err != nil {
+			return err
+		}
+
+		os.Remove(target)
+		if err := os.Link(source, target); err != nil {
+			return err
+		}
+
+		return nil
+	default:
+		// Devices, fifos etc. are not extracted
+		return nil
+	}
+
+	return extractor.restoreAttributes(target, header)
+}
+
+// restoreAttributes restores owners, xattrs, mode and mtime of target.
+// Nothing is restored if target isn't of the entries type anymore, so
+// attributes are never applied through a symlink
+func (extractor *archiveExtractor) restoreAttributes(target string, header *tar.Header) error {
+	fi, err := os.Lstat(target)
+	if err != nil {
+		return err
+	}
+
+	if !matchesEntryType(fi, header) {
+		return nil
+	}
+
+	if extractor.options.Owners {
+		// Not permitted for unprivileged users
+		os.Lchown(target, header.Uid, header.Gid)
+	}
+
+	// Links have no own attributes
+	if header.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+
+	if extractor.options.Xattrs {
+		xattrs := make(map[string]string)
+		for key, value := range header.PAXRecords {
+			if strings.HasPrefix(key, paxXattrPrefix) {
+				xattrs[strings.TrimPrefix(key, paxXattrPrefix)] = value
+			}
+		}
+
+		if err := writeXattrs(target, xattrs); err != nil {
+			return err
+		}
+	}
+
+	// Chmod after chown, which clears setuid bits
+	if err := os.Chmod(target, header.FileInfo().Mode()); err != nil {
+		return err
+	}
+
+	return os.Chtimes(target, time.Now(), header.ModTime)
+}
+
+// matchesEntryType returns true if fi has the type of the entry
+func matchesEntryType(fi os.FileInfo, header *tar.Header) bool {
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return fi.IsDir()
+	case tar.TypeSymlink:
+		return fi.Mode()&os.ModeSymlink != 0
+	case tar.TypeReg, tar.TypeRegA:
+		return fi.Mode().IsRegular()
+	}
+
+	return false
+}
+
+// writeFile writes content into the file target. An existing
+// file or link gets replaced instead of being written through
+func (extractor *archiveExtractor) writeFile(target string, content io.Reader) error {
+	os.Remove(target)
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if extractor.options.Sparse {
+		err = writeSparseFile(f, content)
+	} else {
+		_, err = io.Copy(f, content)
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// writeSparseFile writes content into f. Blocks
+// containing only zeros are skipped, creating holes
+func writeSparseFile(f *os.File, content io.Reader) error {
+	buf := make([]byte, 64*1024)
+	zeros := make([]byte, len(buf))
+
+	var size int64
+	for {
+		n, err := io.ReadFull(content, buf)
+		if n > 0 {
+			if bytes.Equal(buf[:n], zeros[:n]) {
+				_, serr := f.Seek(int64(n), io.SeekCurrent)
+				if serr != nil {
+					return serr
+				}
+			} else if _, werr := f.Write(buf[:n]); werr != nil {
+				return werr
+			}
+
+			size += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Trailing holes have no data
+	return f.Truncate(size)
+}
+
+// extractZip extracts a zip archive. Zip requires random
+// access, so the archive gets buffered into a temporary file
+func (extractor *archiveExtractor) extractZip(r io.Reader) error {
+	tmp, err := ioutil.TempFile("", "dm-extract-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range zr.File {
+		header, err := tar.FileInfoHeader(file.FileInfo(), "")
+		if err != nil {
+			return err
+		}
+		header.Name = file.Name
+
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		// Zip stores the target of a symlink as its content
+		if header.Typeflag == tar.TypeSymlink {
+			link, err := ioutil.ReadAll(rc)
+			if err != nil {
+				rc.Close()
+				return err
+			}
+
+			header.Linkname = string(link)
+		}
+
+		err = extractor.extractTarEntry(header, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return extractor.restoreDirs()
+}
@@ -0,0 +1,208 @@
+package libdatamanager
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testTarEntry an entry of a test archive
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	mode     int64
+	content  string
+}
+
+// buildTestTar builds a tar archive. Linknames
+// starting with "$outside" point into outside
+func buildTestTar(t *testing.T, outside string, entries []testTarEntry) *bytes.Buffer {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+
+	for _, entry := range entries {
+		linkname := entry.linkname
+		if linkname == "$outside" {
+			linkname = outside
+		}
+
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0644
+		}
+
+		header := &tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Linkname: linkname,
+			Mode:     mode,
+			Size:     int64(len(entry.content)),
+			ModTime:  time.Unix(1000000000, 0),
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf
+}
+
+func TestExtractArchiveStaysInsideDest(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testTarEntry
+	}{
+		{
+			name: "dir replaced by symlink",
+			entries: []testTarEntry{
+				{name: "evil/", typeflag: tar.TypeDir, mode: 0777},
+				{name: "evil", typeflag: tar.TypeSymlink, linkname: "$outside"},
+			},
+		},
+		{
+			name: "file through symlink",
+			entries: []testTarEntry{
+				{name: "evil", typeflag: tar.TypeSymlink, linkname: "$outside"},
+				{name: "evil/file", typeflag: tar.TypeReg, mode: 0777, content: "pwned"},
+			},
+		},
+		{
+			name: "dir through symlink",
+			entries: []testTarEntry{
+				{name: "evil", typeflag: tar.TypeSymlink, linkname: "$outside"},
+				{name: "evil/", typeflag: tar.TypeDir, mode: 0777},
+			},
+		},
+		{
+			name: "parent path",
+			entries: []testTarEntry{
+				{name: "../file", typeflag: tar.TypeReg, mode: 0777, content: "pwned"},
+			},
+		},
+		{
+			name: "hardlink outside",
+			entries: []testTarEntry{
+				{name: "link", typeflag: tar.TypeLink, linkname: "../file"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "dm-extract-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+
+			outside := filepath.Join(root, "outside")
+			dest := filepath.Join(root, "dest")
+			if err := os.Mkdir(outside, 0700); err != nil {
+				t.Fatal(err)
+			}
+
+			archive := buildTestTar(t, outside, test.entries)
+			ExtractArchive(archive, dest, ExtractOptions{})
+
+			fi, err := os.Stat(outside)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if fi.Mode().Perm() != 0700 {
+				t.Errorf("mode of outside dir changed to %v", fi.Mode().Perm())
+			}
+
+			files, err := ioutil.ReadDir(outside)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(files) > 0 {
+				t.Errorf("%d files written outside of dest", len(files))
+			}
+
+			if _, err := os.Lstat(filepath.Join(root, "file")); err == nil {
+				t.Error("file written into parent of dest")
+			}
+		})
+	}
+}
+
+func TestExtractArchiveRestoresEntries(t *testing.T) {
+	dest, err := ioutil.TempDir("", "dm-extract-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	archive := buildTestTar(t, "", []testTarEntry{
+		{name: "dir/", typeflag: tar.TypeDir, mode: 0750},
+		{name: "dir/file", typeflag: tar.TypeReg, mode: 0640, content: "content"},
+		{name: "dir/link", typeflag: tar.TypeSymlink, linkname: "file"},
+		{name: "dir/hardlink", typeflag: tar.TypeLink, linkname: "dir/file"},
+	})
+
+	if err := ExtractArchive(archive, dest, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		mode os.FileMode
+	}{
+		{"dir", os.ModeDir | 0750},
+		{"dir/file", 0640},
+		{"dir/link", os.ModeSymlink},
+		{"dir/hardlink", 0640},
+	}
+
+	for _, test := range tests {
+		fi, err := os.Lstat(filepath.Join(dest, test.name))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		mode := fi.Mode()
+		if mode&os.ModeSymlink != 0 {
+			mode = os.ModeSymlink
+		}
+
+		if mode != test.mode {
+			t.Errorf("%s: got mode %v, want %v", test.name, mode, test.mode)
+		}
+
+		if test.mode.IsRegular() {
+			content, err := ioutil.ReadFile(filepath.Join(dest, test.name))
+			if err != nil || string(content) != "content" {
+				t.Errorf("%s: got content %q, %v", test.name, content, err)
+			}
+		}
+	}
+
+	fi, err := os.Stat(filepath.Join(dest, "dir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fi.ModTime().Equal(time.Unix(1000000000, 0)) {
+		t.Errorf("mtime of dir not restored: %v", fi.ModTime())
+	}
+}
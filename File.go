@@ -15,26 +15,31 @@ type FileAttributes struct {
 
 // FileUpdateItem lists changes to a file
 type FileUpdateItem struct {
-	IsPublic     string   `json:"ispublic,omitempty"`
-	NewName      string   `json:"name,omitempty"`
-	NewNamespace string   `json:"namespace,omitempty"`
-	RemoveTags   []string `json:"rem_tags,omitempty"`
-	RemoveGroups []string `json:"rem_groups,omitempty"`
-	AddTags      []string `json:"add_tags,omitempty"`
-	AddGroups    []string `json:"add_groups,omitempty"`
+	IsPublic     string            `json:"ispublic,omitempty"`
+	NewName      string            `json:"name,omitempty"`
+	NewNamespace string            `json:"namespace,omitempty"`
+	RemoveTags   []string          `json:"rem_tags,omitempty"`
+	RemoveGroups []string          `json:"rem_groups,omitempty"`
+	AddTags      []string          `json:"add_tags,omitempty"`
+	AddGroups    []string          `json:"add_groups,omitempty"`
+	SetMeta      map[string]string `json:"set_meta,omitempty"`
+	RemoveMeta   []string          `json:"rem_meta,omitempty"`
 }
 
 // FileResponseItem file item for file response
 type FileResponseItem struct {
-	ID           uint           `json:"id"`
-	Size         int64          `json:"size"`
-	CreationDate time.Time      `json:"creation"`
-	Name         string         `json:"name"`
-	IsPublic     bool           `json:"isPub"`
-	PublicName   string         `json:"pubname"`
-	Attributes   FileAttributes `json:"attrib"`
-	Encryption   int8           `json:"e"`
-	Checksum     string         `json:"checksum"`
+	ID           uint              `json:"id"`
+	Size         int64             `json:"size"`
+	CreationDate time.Time         `json:"creation"`
+	Name         string            `json:"name"`
+	IsPublic     bool              `json:"isPub"`
+	PublicName   string            `json:"pubname"`
+	Attributes   FileAttributes    `json:"attrib"`
+	Encryption   int8              `json:"e"`
+	Checksum     string            `json:"checksum"`
+	Metadata     map[string]string `json:"meta,omitempty"`
+	Parts        int               `json:"parts,omitempty"`
+	PartOf       uint              `json:"partof,omitempty"`
 }
 
 // FileChanges file changes for updating a file
@@ -44,6 +49,8 @@ type FileChanges struct {
 	AddTags, AddGroups       []string
 	RemoveTags, RemoveGroups []string
 	SetPublic, SetPrivate    bool
+	SetMetadata              map[string]string
+	RemoveMetadata           []string
 }
 
 var (
@@ -65,8 +72,32 @@ type ReaderProxy func(io.Reader) io.Reader
 // FileSizeCallback gets called if the filesize is known
 type FileSizeCallback func(int64)
 
-// DeleteFile deletes the desired file(s)
-func (libdm LibDM) DeleteFile(name string, id uint, all bool, attributes FileAttributes) (*IDsResponse, error) {
+// ToUpdateItem converts the changes into a FileUpdateItem
+func (changes FileChanges) ToUpdateItem() FileUpdateItem {
+	var isPublic string
+	if changes.SetPublic {
+		isPublic = "true"
+	}
+	if changes.SetPrivate {
+		isPublic = "false"
+	}
+
+	return FileUpdateItem{
+		IsPublic:     isPublic,
+		NewName:      changes.NewName,
+		NewNamespace: changes.NewNamespace,
+		RemoveTags:   changes.RemoveTags,
+		RemoveGroups: changes.RemoveGroups,
+		AddTags:      changes.AddTags,
+		AddGroups:    changes.AddGroups,
+		SetMeta:      changes.SetMetadata,
+		RemoveMeta:   changes.RemoveMetadata,
+	}
+}
+
+// DeleteFile moves the desired file(s) into the trash of their namespace.
+// If permanent is true, the files are deleted without using the trash
+func (libdm LibDM) DeleteFile(name string, id uint, all bool, attributes FileAttributes, permanent ...bool) (*IDsResponse, error) {
 	var response IDsResponse
 
 	if _, err := libdm.Request(EPFileDelete, &FileRequest{
@@ -74,6 +105,7 @@ func (libdm LibDM) DeleteFile(name string, id uint, all bool, attributes FileAtt
 		FileID:     id,
 		All:        all,
 		Attributes: attributes,
+		Permanent:  len(permanent) > 0 && permanent[0],
 	}, &response, true); err != nil {
 		return nil, err
 	}
@@ -81,46 +113,18 @@ func (libdm LibDM) DeleteFile(name string, id uint, all bool, attributes FileAtt
 	return &response, nil
 }
 
-// ListFiles lists the files corresponding to the args
+// ListFiles lists the files corresponding to the args. Use NewFileQuery
+// for filtering (e.g. by metadata using WithMetadata), ordering and pagination
 func (libdm LibDM) ListFiles(name string, id uint, allNamespaces bool, attributes FileAttributes, verbose uint8) (*FileListResponse, error) {
-	var response FileListResponse
-
-	if _, err := libdm.Request(EPFileList, &FileListRequest{
-		FileID:        id,
-		Name:          name,
-		AllNamespaces: allNamespaces,
-		Attributes:    attributes,
-		OptionalParams: OptionalRequetsParameter{
-			Verbose: verbose,
-		},
-	}, &response, true); err != nil {
-		return nil, err
-	}
+	query := libdm.NewFileQuery(attributes.Namespace).
+		WithName(name).
+		WithID(id).
+		WithVerbosity(verbose)
 
-	return &response, nil
-}
+	query.Params.Attributes = attributes
+	query.Params.AllNamespaces = allNamespaces
 
-// PublishFile publishs a file. If "all" is true, the response object is BulkPublishResponse. Else it is PublishResponse
-func (libdm LibDM) PublishFile(name string, id uint, publicName string, all bool, attributes FileAttributes) (interface{}, error) {
-	request := libdm.NewRequest(EPFilePublish, FileRequest{
-		Name:       name,
-		FileID:     id,
-		PublicName: publicName,
-		All:        all,
-		Attributes: attributes,
-	}).WithAuthFromConfig()
-
-	var err error
-	var response *RestRequestResponse
-	var resp BulkPublishResponse
-
-	response, err = request.Do(&resp)
-
-	if err != nil || response.Status == ResponseError {
-		return nil, NewErrorFromResponse(response, err)
-	}
-
-	return resp, nil
+	return query.Do()
 }
 
 // UpdateFile updates a file on the server
@@ -130,25 +134,6 @@ func (libdm LibDM) UpdateFile(name string, id uint, namespace string, all bool,
 		Namespace: namespace,
 	}
 
-	var isPublic string
-	if changes.SetPublic {
-		isPublic = "true"
-	}
-	if changes.SetPrivate {
-		isPublic = "false"
-	}
-
-	// Set fileUpdates
-	fileUpdates := FileUpdateItem{
-		IsPublic:     isPublic,
-		NewName:      changes.NewName,
-		NewNamespace: changes.NewNamespace,
-		RemoveTags:   changes.RemoveTags,
-		RemoveGroups: changes.RemoveGroups,
-		AddTags:      changes.AddTags,
-		AddGroups:    changes.AddGroups,
-	}
-
 	var response IDsResponse
 
 	// Do request
@@ -156,7 +141,7 @@ func (libdm LibDM) UpdateFile(name string, id uint, namespace string, all bool,
 		Name:       name,
 		FileID:     id,
 		All:        all,
-		Updates:    fileUpdates,
+		Updates:    changes.ToUpdateItem(),
 		Attributes: attributes,
 	}, &response, true); err != nil {
 		return nil, err
@@ -0,0 +1,86 @@
+package libdatamanager
+
+// CopyOptions options for copying files
+type CopyOptions struct {
+	// NewName name of the copy. Only
+	// used if a single file is copied
+	NewName string
+
+	// Tags and Groups replace the attributes
+	// of the source file if not nil
+	Tags, Groups []string
+
+	// TagMap and GroupMap rename attributes
+	// of the source file (old -> new)
+	TagMap, GroupMap map[string]string
+
+	// Public state of the copies. By
+	// default copies are private
+	SetPublic  bool
+	PublicName string
+}
+
+// CopyFile copies the desired file into targetNamespace. If all is true, all
+// files matching attributes are copied. If a keystore is set, keys of
+// encrypted files are copied as well
+func (libdm LibDM) CopyFile(name string, id uint, all bool, attributes FileAttributes, targetNamespace string, options CopyOptions) (*CopyResponse, error) {
+	request := &FileCopyRequest{
+		Name:            name,
+		FileID:          id,
+		All:             all,
+		Attributes:      attributes,
+		TargetNamespace: targetNamespace,
+		Tags:            options.Tags,
+		Groups:          options.Groups,
+		TagMap:          options.TagMap,
+		GroupMap:        options.GroupMap,
+		IsPublic:        "false",
+	}
+
+	if !all {
+		request.NewName = options.NewName
+	}
+
+	if options.SetPublic {
+		request.IsPublic = "true"
+		request.PublicName = options.PublicName
+	}
+
+	var response CopyResponse
+	if _, err := libdm.Request(EPFileCopy, request, &response, true); err != nil {
+		return nil, err
+	}
+
+	// The content is copied, so the copies require the same keys
+	if err := libdm.copyKeys(&response); err != nil {
+		return &response, err
+	}
+
+	return &response, nil
+}
+
+// copyKeys copies keystore entries of the source files to the copies
+func (libdm LibDM) copyKeys(response *CopyResponse) error {
+	keystore := libdm.getKeystore()
+	if keystore == nil {
+		return nil
+	}
+
+	for _, file := range response.Files {
+		has, err := keystore.HasKey(file.SourceID)
+		if err != nil {
+			return err
+		}
+
+		// Source not encrypted or key unknown
+		if !has {
+			continue
+		}
+
+		if err := keystore.CopyKey(file.SourceID, file.FileID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
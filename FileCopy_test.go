@@ -0,0 +1,133 @@
+package libdatamanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// newTestCopyServer copies files to IDs increased by 100. Copying all
+// files copies the files 1 and 2, otherwise the requested file is copied
+func newTestCopyServer(t *testing.T) (*LibDM, *FileCopyRequest) {
+	t.Helper()
+
+	var request FileCopyRequest
+	libdm := newTestServer(t, map[Endpoint]interface{}{
+		EPFileCopy: testHandler(func(r *http.Request) interface{} {
+			request = FileCopyRequest{}
+			json.NewDecoder(r.Body).Decode(&request)
+
+			sources := []uint{request.FileID}
+			if request.All {
+				sources = []uint{1, 2}
+			}
+
+			var response CopyResponse
+			for _, id := range sources {
+				response.Files = append(response.Files, CopiedFile{SourceID: id, FileID: id + 100})
+			}
+
+			return response
+		}),
+	})
+
+	return libdm, &request
+}
+
+func TestCopyFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         uint
+		all        bool
+		options    CopyOptions
+		wantName   string
+		wantPublic string
+		wantPub    string
+	}{
+		{
+			name:       "single",
+			id:         1,
+			options:    CopyOptions{NewName: "copy"},
+			wantName:   "copy",
+			wantPublic: "false",
+		},
+		{
+			name:       "all ignores new name",
+			all:        true,
+			options:    CopyOptions{NewName: "copy"},
+			wantPublic: "false",
+		},
+		{
+			name:       "public",
+			id:         2,
+			options:    CopyOptions{SetPublic: true, PublicName: "public"},
+			wantPublic: "true",
+			wantPub:    "public",
+		},
+		{
+			name:       "public name without public state",
+			id:         2,
+			options:    CopyOptions{PublicName: "public"},
+			wantPublic: "false",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			libdm, request := newTestCopyServer(t)
+
+			if _, err := libdm.CopyFile("", test.id, test.all, FileAttributes{Namespace: "ns"}, "target", test.options); err != nil {
+				t.Fatal(err)
+			}
+
+			if request.NewName != test.wantName {
+				t.Errorf("got new name %q, want %q", request.NewName, test.wantName)
+			}
+
+			if request.IsPublic != test.wantPublic || request.PublicName != test.wantPub {
+				t.Errorf("got public %s (%q), want %s (%q)", request.IsPublic, request.PublicName, test.wantPublic, test.wantPub)
+			}
+
+			if request.TargetNamespace != "target" {
+				t.Errorf("got target namespace %q, want target", request.TargetNamespace)
+			}
+		})
+	}
+}
+
+func TestCopyFileKeys(t *testing.T) {
+	libdm, _ := newTestCopyServer(t)
+	store := newTestKeystore(t)
+	libdm.WithKeystore(store)
+
+	// Only file 1 is encrypted
+	saveTestKey(t, libdm.getKeystore(), 1, "0123456789abcdef0123456789abcdef")
+
+	response, err := libdm.CopyFile("", 0, true, FileAttributes{}, "target", CopyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(response.Files) != 2 {
+		t.Fatalf("got %d copies, want 2", len(response.Files))
+	}
+
+	key, err := libdm.getKeystore().GetKey(101)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(key) != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("got copied key %q", key)
+	}
+
+	if has, err := libdm.getKeystore().HasKey(102); err != nil || has {
+		t.Errorf("got key for unencrypted copy: %v %v", has, err)
+	}
+
+	// Keystore errors must not be ignored
+	store.DB.Close()
+	if _, err := libdm.CopyFile("", 1, false, FileAttributes{}, "target", CopyOptions{}); err == nil {
+		t.Error("got no error from a closed keystore")
+	}
+}
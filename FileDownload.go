@@ -2,6 +2,7 @@ package libdatamanager
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"hash/crc32"
 	"io"
@@ -9,8 +10,6 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
-
-	gzip "github.com/klauspost/pgzip"
 )
 
 var (
@@ -23,6 +22,9 @@ var (
 
 	// ErrFileEncrypted error if no key was given and nodecrypt is false
 	ErrFileEncrypted = errors.New("file is encrypted but no key was given")
+
+	// ErrCompressionNotSupported if compression is not supported
+	ErrCompressionNotSupported = errors.New("compression not supported")
 )
 
 // FileDownloadRequest request for downloading a file
@@ -31,13 +33,17 @@ type FileDownloadRequest struct {
 	ID             uint
 	Name           string
 	Namespace      string
+	Version        uint
 	Decrypt        bool
+	Decompress     bool
 	Key            []byte
 	Buffersize     int
 	ignoreChecksum bool
 	CancelDownload chan bool
 	WriterProxy    WriterProxy
 	ReaderProxy    ReaderProxy
+	RequestLimiter *RateLimiter
+	progress       ProgressCallback
 }
 
 // NewFileRequest create a new filerequest
@@ -46,6 +52,7 @@ func (libdm LibDM) NewFileRequest(id uint, name, namespace string) *FileDownload
 		LibDM:      libdm,
 		Buffersize: DefaultBuffersize,
 		Decrypt:    true,
+		Decompress: true,
 		Name:       name,
 		Namespace:  namespace,
 		ID:         id,
@@ -57,6 +64,7 @@ func (libdm LibDM) NewFileRequestByName(name, namespace string) *FileDownloadReq
 	return &FileDownloadRequest{
 		LibDM:      libdm,
 		Decrypt:    true,
+		Decompress: true,
 		Name:       name,
 		Namespace:  namespace,
 		Buffersize: DefaultBuffersize,
@@ -68,6 +76,7 @@ func (libdm LibDM) NewFileRequestByID(fileID uint) *FileDownloadRequest {
 	return &FileDownloadRequest{
 		LibDM:      libdm,
 		Decrypt:    true,
+		Decompress: true,
 		ID:         fileID,
 		Buffersize: DefaultBuffersize,
 	}
@@ -99,6 +108,27 @@ func (fileRequest *FileDownloadRequest) GetBuffersize() int {
 	return fileRequest.Buffersize
 }
 
+// WithVersion download the given version of the file
+// instead of the current one
+func (fileRequest *FileDownloadRequest) WithVersion(version uint) *FileDownloadRequest {
+	fileRequest.Version = version
+	return fileRequest
+}
+
+// OnProgress sets the callback receiving progress events. The last
+// event has PhaseDone and contains the result of the download
+func (fileRequest *FileDownloadRequest) OnProgress(cb ProgressCallback) *FileDownloadRequest {
+	fileRequest.progress = cb
+	return fileRequest
+}
+
+// WithRateLimiter limits the bandwidth of this download.
+// The limit of the LibDM applies as well
+func (fileRequest *FileDownloadRequest) WithRateLimiter(limiter *RateLimiter) *FileDownloadRequest {
+	fileRequest.RequestLimiter = limiter
+	return fileRequest
+}
+
 // IgnoreChecksum ignores the checksum
 func (fileRequest *FileDownloadRequest) IgnoreChecksum() *FileDownloadRequest {
 	fileRequest.ignoreChecksum = true
@@ -111,6 +141,12 @@ func (fileRequest *FileDownloadRequest) NoDecrypt() *FileDownloadRequest {
 	return fileRequest
 }
 
+// NoDecompress don't decompress compressed files while downloading
+func (fileRequest *FileDownloadRequest) NoDecompress() *FileDownloadRequest {
+	fileRequest.Decompress = false
+	return fileRequest
+}
+
 // DecryptWith sets key to decrypt file with. If key is nil, no decryption will be performed
 func (fileRequest *FileDownloadRequest) DecryptWith(key []byte) *FileDownloadRequest {
 	if key == nil {
@@ -125,8 +161,9 @@ func (fileRequest *FileDownloadRequest) DecryptWith(key []byte) *FileDownloadReq
 // The response body must be closed
 func (fileRequest *FileDownloadRequest) Do() (*FileDownloadResponse, error) {
 	resp, err := fileRequest.NewRequest(EPFileGet, &FileRequest{
-		Name:   fileRequest.Name,
-		FileID: fileRequest.ID,
+		Name:    fileRequest.Name,
+		FileID:  fileRequest.ID,
+		Version: fileRequest.Version,
 		Attributes: FileAttributes{
 			Namespace: fileRequest.Namespace,
 		},
@@ -159,6 +196,10 @@ func (fileRequest *FileDownloadRequest) Do() (*FileDownloadResponse, error) {
 	encryption := resp.Header.Get(HeaderEncryption)
 	// Get filetype
 	fileType := resp.Header.Get(HeaderFileType)
+	// Get pipeline order header
+	pipeline := PipelineOrder(resp.Header.Get(HeaderPipeline))
+	// Get compression header
+	compression, legacyCompression := parseStoredCompression(resp.Header.Get(HeaderCompression), pipeline)
 	// Get size header
 	size := GetFilesizeFromDownloadRequest(resp)
 	// Get size header
@@ -175,12 +216,51 @@ func (fileRequest *FileDownloadRequest) Do() (*FileDownloadResponse, error) {
 		}
 	}
 
+	// Get the key from the keystore if required
+	if fileRequest.Decrypt && len(encryption) > 0 && len(fileRequest.Key) == 0 && fileRequest.Keystore != nil {
+		keystore := fileRequest.getKeystore()
+
+		key, err := keystore.GetKey(id)
+		if err != nil {
+			resp.Body.Close()
+			return nil, &KeyMissingError{
+				FileID:    id,
+				ServerURL: keystore.ServerURL,
+				Username:  keystore.Username,
+				Err:       err,
+			}
+		}
+
+		fileRequest.Key = key
+	}
+
+	// Split files return their manifest
+	var manifest *FileManifest
+	if parts, _ := strconv.Atoi(resp.Header.Get(HeaderParts)); parts > 0 {
+		manifest = &FileManifest{}
+		err := json.NewDecoder(resp.Body).Decode(manifest)
+		resp.Body.Close()
+		if err != nil {
+			return nil, &ResponseErr{
+				Err: err,
+			}
+		}
+
+		checksum = manifest.Checksum
+		size = manifest.Size
+	}
+
 	// Return file response
 	return &FileDownloadResponse{
 		Response:        resp,
 		ServerChecksum:  checksum,
 		Encryption:      encryption,
 		FileType:        fileType,
+		Compression:     compression,
+		Pipeline:        pipeline,
+		Extract:         fileRequest.Decompress,
+		legacyGzip:      legacyCompression,
+		Manifest:        manifest,
 		ServerFileName:  serverFileName,
 		Size:            size,
 		DownloadRequest: fileRequest,
@@ -257,7 +337,11 @@ type FileDownloadResponse struct {
 	FileID          uint
 	Extract         bool
 	FileType        string
+	Compression     Compression
+	Pipeline        PipelineOrder
+	Manifest        *FileManifest
 	DownloadRequest *FileDownloadRequest
+	legacyGzip      bool
 }
 
 // VerifyChecksum Return if checksums are equal and not empty
@@ -266,56 +350,104 @@ func (fileresponse *FileDownloadResponse) VerifyChecksum() bool {
 }
 
 // SaveTo download a file and write it to the writer while
-func (fileresponse *FileDownloadResponse) SaveTo(w io.Writer, cancelChan chan bool) error {
+func (fileresponse *FileDownloadResponse) SaveTo(w io.Writer, cancelChan chan bool) (err error) {
 	defer fileresponse.Response.Body.Close()
 
-	var err error
+	phase := PhaseDownloading
+	if fileresponse.DownloadRequest.Decrypt && len(fileresponse.Encryption) > 0 {
+		phase = PhaseDecrypting
+	}
+	tracker := newProgressTracker(fileresponse.DownloadRequest.progress, phase, fileresponse.Size)
+
+	// Send final progress event
+	defer func() {
+		if err == nil {
+			tracker.setPhase(PhaseVerifying)
+			if !fileresponse.DownloadRequest.ignoreChecksum && !fileresponse.VerifyChecksum() {
+				tracker.setErr(ErrChecksumNotMatch)
+			}
+		}
+
+		tracker.finish(fileresponse.LocalChecksum, err)
+	}()
+
+	// Reassemble split files
+	if fileresponse.Manifest != nil {
+		return fileresponse.saveParts(w, cancelChan, tracker)
+	}
+
 	buff := make([]byte, fileresponse.DownloadRequest.GetBuffersize())
 	hash := crc32.NewIEEE()
 
-	reader := io.TeeReader(fileresponse.DownloadRequest.GetReaderProxy()(fileresponse.Response.Body), hash)
+	// Apply ratelimits to the received stream
+	request := fileresponse.DownloadRequest
+	var reader io.Reader = request.RateLimiter.Reader(request.RequestLimiter.Reader(fileresponse.Response.Body))
+
+	reader = io.TeeReader(tracker.reader(request.GetReaderProxy()(reader)), hash)
+
+	encrypted := len(fileresponse.Encryption) > 0
+	decrypt := request.Decrypt && encrypted
+
+	// New files got compressed before encryption, so
+	// decompress them after decrypting the stream
+	compressedPlaintext := fileresponse.Pipeline == OrderCompressEncrypt && encrypted
+
+	// Throw error if no key was given
+	if decrypt && len(request.Key) == 0 {
+		return ErrFileEncrypted
+	}
 
-	var gz *gzip.Reader
-	// TODO let the server decide whether to
-	// extract. Otherwise compressed files
-	// can't be decrypted correctly!!
-	if fileresponse.Extract {
-		gz, err = gzip.NewReader(reader)
+	// Legacy files without compression header were stored using gzip
+	compression := fileresponse.Compression
+	if fileresponse.legacyGzip {
+		compression = CompressionGzip
+	}
+
+	// Uncompressed files can't be extracted
+	extract := fileresponse.Extract && compression != CompressionNone
+
+	var decompressor io.ReadCloser
+	if extract && !compressedPlaintext {
+		// Legacy files were compressed after
+		// encryption, so decompress them first
+		decompressor, err = newDecompressReader(compression, reader)
 		if err != nil {
 			return err
 		}
 
-		reader = gz
+		reader = decompressor
 	}
 
-	w = fileresponse.DownloadRequest.GetWriterProxy()(w)
+	w = request.GetWriterProxy()(w)
 
-	// If decryption is requested and required
-	if fileresponse.DownloadRequest.Decrypt && len(fileresponse.Encryption) > 0 {
-		// Throw error if no key was given
-		if len(fileresponse.DownloadRequest.Key) == 0 {
-			return ErrFileEncrypted
-		}
+	switch {
+	case decrypt && extract && compressedPlaintext:
+		// Decrypt into a pipe and decompress the
+		// decrypted stream afterwards
+		pR, pW := io.Pipe()
+		go func() {
+			pW.CloseWithError(fileresponse.decrypt(reader, pW, buff))
+		}()
 
-		switch fileresponse.Encryption {
-		case EncryptionCiphers[0]:
-			// Decrypt aes
-			err = DecryptAES(reader, &w, nil, fileresponse.DownloadRequest.Key, buff, fileresponse.DownloadRequest.CancelDownload)
-		case EncryptionCiphers[1]:
-			// Decrypt aes
-			err = DecryptAGE(reader, w, nil, fileresponse.DownloadRequest.Key, buff, fileresponse.DownloadRequest.CancelDownload)
-		default:
-			return ErrCipherNotSupported
+		decompressor, err = newDecompressReader(compression, pR)
+		if err != nil {
+			pR.CloseWithError(err)
+			return err
 		}
-	} else {
+
+		err = cancelledCopy(w, decompressor, make([]byte, len(buff)), cancelChan)
+		pR.Close()
+	case decrypt:
+		err = fileresponse.decrypt(reader, w, buff)
+	default:
 		// Use multiwriter to write to hash and file
 		// at the same time
 		err = cancelledCopy(w, reader, buff, cancelChan)
 	}
 
-	// Close gzipWriter
-	if fileresponse.Extract {
-		gz.Close()
+	// Close decompressor
+	if decompressor != nil {
+		decompressor.Close()
 	}
 
 	if err != nil {
@@ -327,6 +459,22 @@ func (fileresponse *FileDownloadResponse) SaveTo(w io.Writer, cancelChan chan bo
 	return nil
 }
 
+// decrypt decrypts in and writes the plaintext to out
+func (fileresponse *FileDownloadResponse) decrypt(in io.Reader, out io.Writer, buff []byte) error {
+	request := fileresponse.DownloadRequest
+
+	switch fileresponse.Encryption {
+	case EncryptionCiphers[1]:
+		// Decrypt aes
+		return DecryptAES(in, &out, nil, request.Key, buff, request.CancelDownload)
+	case EncryptionCiphers[2]:
+		// Decrypt age
+		return DecryptAGE(in, out, nil, request.Key, buff, request.CancelDownload)
+	}
+
+	return ErrCipherNotSupported
+}
+
 func cancelledCopy(writer io.Writer, f io.Reader, buf []byte, cancelChan chan bool) error {
 	for {
 		// Exit on cancel
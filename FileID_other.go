@@ -0,0 +1,11 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package libdatamanager
+
+import "os"
+
+// getFileID files can't be identified on this OS
+func getFileID(fi os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,22 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package libdatamanager
+
+import (
+	"os"
+	"syscall"
+)
+
+// getFileID returns the device and inode of fi
+func getFileID(fi os.FileInfo) (fileID, bool) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+
+	return fileID{
+		Device: uint64(stat.Dev),
+		Inode:  uint64(stat.Ino),
+	}, true
+}
@@ -0,0 +1,255 @@
+package libdatamanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// FileIterator iterates over the files of a query. Pages are
+// requested lazily and decoded incrementally, so only a single
+// file is held in memory at once
+type FileIterator struct {
+	query   *FileQuery
+	body    io.ReadCloser
+	dec     *json.Decoder
+	inArray bool
+	cursor  string
+	count   uint
+	file    FileResponseItem
+	err     error
+	done    bool
+}
+
+// Iterate returns an iterator over all files matching the query
+// requesting pageSize files at once. The iterator must be closed
+// if it gets abandoned before Next returned false
+func (query *FileQuery) Iterate(pageSize uint) *FileIterator {
+	q := *query
+	q.Params.Limit = pageSize
+
+	return &FileIterator{
+		query: &q,
+	}
+}
+
+// Next advances to the next file. It returns false if there
+// are no more files or an error occurred
+func (iterator *FileIterator) Next() bool {
+	for !iterator.done && iterator.err == nil {
+		// Request next page
+		if iterator.dec == nil {
+			if iterator.err = iterator.fetch(); iterator.err != nil {
+				break
+			}
+		}
+
+		if iterator.inArray {
+			if iterator.dec.More() {
+				iterator.file = FileResponseItem{}
+				if iterator.err = iterator.dec.Decode(&iterator.file); iterator.err != nil {
+					break
+				}
+
+				iterator.count++
+				return true
+			}
+
+			// Consume closing ']'
+			if _, iterator.err = iterator.dec.Token(); iterator.err != nil {
+				break
+			}
+			iterator.inArray = false
+		}
+
+		// Read remaining keys of the page
+		if iterator.err = iterator.readKeys(); iterator.err != nil || iterator.inArray {
+			continue
+		}
+
+		// Page done
+		iterator.closeBody()
+		if !iterator.nextPage() {
+			iterator.done = true
+			break
+		}
+	}
+
+	iterator.closeBody()
+	return false
+}
+
+// nextPage advances the query to the next page like FileQuery.NextPage.
+// Returns false if the current page was the last one
+func (iterator *FileIterator) nextPage() bool {
+	params := &iterator.query.Params
+	count := iterator.count
+	iterator.count = 0
+
+	switch {
+	case len(iterator.cursor) > 0:
+		params.Cursor = iterator.cursor
+		params.Offset = 0
+		iterator.cursor = ""
+	case params.Limit > 0 && len(params.Cursor) == 0 && count == params.Limit:
+		// Servers without cursor support
+		params.Offset += params.Limit
+	default:
+		return false
+	}
+
+	return true
+}
+
+// File returns the current file
+func (iterator *FileIterator) File() FileResponseItem {
+	return iterator.file
+}
+
+// Err returns the error which stopped the iteration
+func (iterator *FileIterator) Err() error {
+	return iterator.err
+}
+
+// Cursor returns the cursor of the current page. It can be
+// used to resume listing with FileQuery.After
+func (iterator *FileIterator) Cursor() string {
+	return iterator.query.Params.Cursor
+}
+
+// Close stops the iteration
+func (iterator *FileIterator) Close() error {
+	iterator.done = true
+	return iterator.closeBody()
+}
+
+// Chan returns a channel receiving all files. The channel gets closed
+// once all files were sent, an error occurred or cancel received a value
+func (iterator *FileIterator) Chan(cancel chan bool) <-chan FileResponseItem {
+	files := make(chan FileResponseItem)
+
+	go func() {
+		defer close(files)
+		defer iterator.Close()
+
+		for iterator.Next() {
+			select {
+			case files <- iterator.File():
+			case <-cancel:
+				iterator.err = ErrCancelled
+				return
+			}
+		}
+	}()
+
+	return files
+}
+
+func (iterator *FileIterator) closeBody() error {
+	iterator.dec = nil
+	iterator.inArray = false
+
+	if iterator.body == nil {
+		return nil
+	}
+
+	err := iterator.body.Close()
+	iterator.body = nil
+	return err
+}
+
+// fetch requests the next page and reads the opening '{'
+func (iterator *FileIterator) fetch() error {
+	resp, err := iterator.query.NewRequest(EPFileList, iterator.query.BuildRequest()).
+		WithConnectionLimit(iterator.query.MaxConnectionsPerHost).
+		WithAuthFromConfig().
+		DoHTTPRequest()
+	if err != nil {
+		return NewErrorFromResponse(nil, err)
+	}
+
+	if resp.StatusCode != 200 {
+		defer resp.Body.Close()
+
+		response := &RestRequestResponse{
+			HTTPCode: resp.StatusCode,
+			Headers:  &resp.Header,
+			Status:   ResponseError,
+		}
+
+		// Read error message
+		var errRes ErrorResponse
+		if d, err := ioutil.ReadAll(resp.Body); err == nil && json.Unmarshal(d, &errRes) == nil {
+			response.Message = errRes.Message
+		}
+
+		return NewErrorFromResponse(response)
+	}
+
+	iterator.body = resp.Body
+	iterator.dec = json.NewDecoder(resp.Body)
+
+	return iterator.expectDelim('{')
+}
+
+// readKeys reads keys of the response object until
+// the file array starts or the object ends
+func (iterator *FileIterator) readKeys() error {
+	for {
+		token, err := iterator.dec.Token()
+		if err != nil {
+			return err
+		}
+
+		// End of response object
+		if token == json.Delim('}') {
+			return nil
+		}
+
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("unexpected token %v", token)
+		}
+
+		switch strings.ToLower(key) {
+		case "files":
+			// Files might be null
+			token, err := iterator.dec.Token()
+			if err != nil {
+				return err
+			}
+
+			if token == json.Delim('[') {
+				iterator.inArray = true
+				return nil
+			} else if token != nil {
+				return fmt.Errorf("unexpected token %v", token)
+			}
+		case "cursor":
+			if err := iterator.dec.Decode(&iterator.cursor); err != nil {
+				return err
+			}
+		default:
+			// Skip unknown values
+			var raw json.RawMessage
+			if err := iterator.dec.Decode(&raw); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (iterator *FileIterator) expectDelim(delim json.Delim) error {
+	token, err := iterator.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if token != delim {
+		return fmt.Errorf("expected %v got %v", delim, token)
+	}
+
+	return nil
+}
@@ -0,0 +1,283 @@
+package libdatamanager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OrderKey a key to order files by
+type OrderKey string
+
+// Available order keys
+const (
+	OrderByID         OrderKey = "id"
+	OrderByName       OrderKey = "name"
+	OrderBySize       OrderKey = "size"
+	OrderByCreated    OrderKey = "created"
+	OrderByPublicName OrderKey = "pubname"
+	OrderByNamespace  OrderKey = "namespace"
+)
+
+var (
+	// ErrInvalidOrder error if an order string can't be parsed
+	ErrInvalidOrder = errors.New("invalid order")
+)
+
+// FileOrder order of files in a list response
+type FileOrder struct {
+	Key     OrderKey
+	Reverse bool
+}
+
+// String returns the order in the "key[/r]" format
+func (order FileOrder) String() string {
+	if order.Reverse {
+		return string(order.Key) + "/r"
+	}
+
+	return string(order.Key)
+}
+
+// ParseFileOrder parses orders in the format used by the
+// config ("created/r"). Multiple orders are separated by a comma
+func ParseFileOrder(s string) ([]FileOrder, error) {
+	var orders []FileOrder
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if len(part) == 0 {
+			continue
+		}
+
+		var order FileOrder
+		if strings.HasSuffix(part, "/r") {
+			order.Reverse = true
+			part = strings.TrimSuffix(part, "/r")
+		}
+
+		switch key := OrderKey(part); key {
+		case OrderByID, OrderByName, OrderBySize, OrderByCreated, OrderByPublicName, OrderByNamespace:
+			order.Key = key
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidOrder, part)
+		}
+
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+// FileQuery a query for listing files
+type FileQuery struct {
+	LibDM
+	Params FileListRequest
+	Orders []FileOrder
+}
+
+// NewFileQuery create a new query listing files in namespace.
+// Parts of split files are hidden, see IncludeParts
+func (libdm LibDM) NewFileQuery(namespace string) *FileQuery {
+	return &FileQuery{
+		LibDM: libdm,
+		Params: FileListRequest{
+			Attributes: FileAttributes{
+				Namespace: namespace,
+			},
+			HideParts: true,
+		},
+	}
+}
+
+// IncludeParts list the parts of split files as well
+func (query *FileQuery) IncludeParts() *FileQuery {
+	query.Params.HideParts = false
+	return query
+}
+
+// filter returns the filter of the request
+func (query *FileQuery) filter() *FileFilter {
+	if query.Params.Filter == nil {
+		query.Params.Filter = &FileFilter{}
+	}
+
+	return query.Params.Filter
+}
+
+// WithID only list the file with the given ID
+func (query *FileQuery) WithID(id uint) *FileQuery {
+	query.Params.FileID = id
+	return query
+}
+
+// WithName only list files with the given name
+func (query *FileQuery) WithName(name string) *FileQuery {
+	query.Params.Name = name
+	return query
+}
+
+// WithNamePattern only list files matching the given pattern.
+// '*' matches any sequence of characters, '?' a single one
+func (query *FileQuery) WithNamePattern(pattern string) *FileQuery {
+	query.filter().NamePattern = pattern
+	return query
+}
+
+// AllNamespaces list files of all namespaces
+func (query *FileQuery) AllNamespaces() *FileQuery {
+	query.Params.AllNamespaces = true
+	return query
+}
+
+// WithVerbosity set the verbosity of the response
+func (query *FileQuery) WithVerbosity(verbose uint8) *FileQuery {
+	query.Params.OptionalParams.Verbose = verbose
+	return query
+}
+
+// SizeBetween only list files with min <= size <= max.
+// A value <= 0 disables the corresponding bound
+func (query *FileQuery) SizeBetween(min, max int64) *FileQuery {
+	query.filter().MinSize = min
+	query.filter().MaxSize = max
+	return query
+}
+
+// CreatedBetween only list files created between from and to.
+// A zero time disables the corresponding bound
+func (query *FileQuery) CreatedBetween(from, to time.Time) *FileQuery {
+	filter := query.filter()
+	filter.CreatedAfter = nil
+	filter.CreatedBefore = nil
+
+	if !from.IsZero() {
+		filter.CreatedAfter = &from
+	}
+	if !to.IsZero() {
+		filter.CreatedBefore = &to
+	}
+
+	return query
+}
+
+// Encrypted only list files which are (not) encrypted
+func (query *FileQuery) Encrypted(encrypted bool) *FileQuery {
+	query.filter().Encrypted = &encrypted
+	return query
+}
+
+// Public only list files which are (not) public
+func (query *FileQuery) Public(public bool) *FileQuery {
+	query.filter().Public = &public
+	return query
+}
+
+// WithTags only list files having the given tags. If mode is
+// MatchAny, files need at least one of them, otherwise all
+func (query *FileQuery) WithTags(mode MatchMode, tags ...string) *FileQuery {
+	query.Params.Attributes.Tags = tags
+	query.filter().TagMode = mode
+	return query
+}
+
+// WithGroups only list files in the given groups. If mode is
+// MatchAny, files need at least one of them, otherwise all
+func (query *FileQuery) WithGroups(mode MatchMode, groups ...string) *FileQuery {
+	query.Params.Attributes.Groups = groups
+	query.filter().GroupMode = mode
+	return query
+}
+
+// WithMetadata only list files having the given metadata value
+func (query *FileQuery) WithMetadata(key, value string) *FileQuery {
+	filter := query.filter()
+	if filter.Metadata == nil {
+		filter.Metadata = make(map[string]string)
+	}
+
+	filter.Metadata[key] = value
+	return query
+}
+
+// OrderBy appends an order key. Files are ordered by the
+// first key, equal files by the next one and so on
+func (query *FileQuery) OrderBy(key OrderKey, reverse bool) *FileQuery {
+	query.Orders = append(query.Orders, FileOrder{
+		Key:     key,
+		Reverse: reverse,
+	})
+	return query
+}
+
+// OrderByString appends the orders of an order string like "created/r"
+func (query *FileQuery) OrderByString(order string) (*FileQuery, error) {
+	orders, err := ParseFileOrder(order)
+	if err != nil {
+		return nil, err
+	}
+
+	query.Orders = append(query.Orders, orders...)
+	return query, nil
+}
+
+// Limit return at most limit files
+func (query *FileQuery) Limit(limit uint) *FileQuery {
+	query.Params.Limit = limit
+	return query
+}
+
+// Offset skip the first offset files
+func (query *FileQuery) Offset(offset uint) *FileQuery {
+	query.Params.Offset = offset
+	return query
+}
+
+// After continue listing at the given cursor. The cursor
+// is returned as NextCursor by a previous response
+func (query *FileQuery) After(cursor string) *FileQuery {
+	query.Params.Cursor = cursor
+	return query
+}
+
+// BuildRequest returns the request sent to the server
+func (query *FileQuery) BuildRequest() *FileListRequest {
+	request := query.Params
+
+	orders := make([]string, len(query.Orders))
+	for i := range query.Orders {
+		orders[i] = query.Orders[i].String()
+	}
+	request.Order = strings.Join(orders, ",")
+
+	return &request
+}
+
+// Do executes the query
+func (query *FileQuery) Do() (*FileListResponse, error) {
+	var response FileListResponse
+
+	if _, err := query.Request(EPFileList, query.BuildRequest(), &response, true); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// NextPage returns a query for the page following response. If
+// there is no following page, nil is returned
+func (query *FileQuery) NextPage(response *FileListResponse) *FileQuery {
+	next := *query
+
+	switch {
+	case len(response.NextCursor) > 0:
+		next.Params.Cursor = response.NextCursor
+	case query.Params.Limit > 0 && len(query.Params.Cursor) == 0 && uint(len(response.Files)) == query.Params.Limit:
+		next.Params.Offset += query.Params.Limit
+	default:
+		return nil
+	}
+
+	return &next
+}
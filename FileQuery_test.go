@@ -0,0 +1,130 @@
+package libdatamanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestFileQueryHidesParts(t *testing.T) {
+	var requests []FileListRequest
+	libdm := newTestServer(t, map[Endpoint]interface{}{
+		EPFileList: testHandler(func(r *http.Request) interface{} {
+			var request FileListRequest
+			json.NewDecoder(r.Body).Decode(&request)
+			requests = append(requests, request)
+
+			return FileListResponse{}
+		}),
+	})
+
+	tests := []struct {
+		name  string
+		query *FileQuery
+		want  bool
+	}{
+		{"query", libdm.NewFileQuery("default"), true},
+		{"including parts", libdm.NewFileQuery("default").IncludeParts(), false},
+	}
+
+	for _, test := range tests {
+		requests = nil
+		if _, err := test.query.Do(); err != nil {
+			t.Fatal(err)
+		}
+
+		iterator := test.query.Iterate(10)
+		for iterator.Next() {
+		}
+
+		if err := iterator.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(requests) != 2 {
+			t.Fatalf("%s: got %d requests, want 2", test.name, len(requests))
+		}
+
+		for _, request := range requests {
+			if request.HideParts != test.want {
+				t.Errorf("%s: got HideParts %v, want %v", test.name, request.HideParts, test.want)
+			}
+		}
+	}
+}
+
+func TestFileIteratorPages(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        int
+		pageSize     uint
+		cursors      bool
+		wantRequests int
+	}{
+		{name: "offsets", files: 25, pageSize: 10, wantRequests: 3},
+		{name: "offsets full last page", files: 20, pageSize: 10, wantRequests: 3},
+		{name: "cursors", files: 25, pageSize: 10, cursors: true, wantRequests: 3},
+		{name: "cursors full last page", files: 20, pageSize: 10, cursors: true, wantRequests: 2},
+		{name: "single page", files: 5, pageSize: 10, wantRequests: 1},
+		{name: "no page size", files: 5, wantRequests: 1},
+		{name: "empty", pageSize: 10, wantRequests: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests int
+			libdm := newTestServer(t, map[Endpoint]interface{}{
+				EPFileList: testHandler(func(r *http.Request) interface{} {
+					var request FileListRequest
+					json.NewDecoder(r.Body).Decode(&request)
+					requests++
+
+					// Cursors are the offset of the next page
+					start := int(request.Offset)
+					if len(request.Cursor) > 0 {
+						start, _ = strconv.Atoi(request.Cursor)
+					}
+
+					end := test.files
+					if request.Limit > 0 && start+int(request.Limit) < end {
+						end = start + int(request.Limit)
+					}
+
+					var response FileListResponse
+					for id := start; id < end; id++ {
+						response.Files = append(response.Files, FileResponseItem{ID: uint(id)})
+					}
+
+					if test.cursors && end < test.files {
+						response.NextCursor = strconv.Itoa(end)
+					}
+
+					return response
+				}),
+			})
+
+			iterator := libdm.NewFileQuery("default").Iterate(test.pageSize)
+
+			var files int
+			for iterator.Next() {
+				if id := iterator.File().ID; id != uint(files) {
+					t.Fatalf("got file %d, want %d", id, files)
+				}
+				files++
+			}
+
+			if err := iterator.Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			if files != test.files {
+				t.Errorf("got %d files, want %d", files, test.files)
+			}
+
+			if requests != test.wantRequests {
+				t.Errorf("got %d requests, want %d", requests, test.wantRequests)
+			}
+		})
+	}
+}
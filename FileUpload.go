@@ -9,12 +9,8 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
-	"net/http"
-	"net/url"
 	"os"
-	"strconv"
 
-	"github.com/JojiiOfficial/gaw"
 	gzip "github.com/klauspost/pgzip"
 )
 
@@ -50,7 +46,26 @@ type UploadRequest struct {
 	ProxyWriter      WriterProxy
 	ProxyReader      ReaderProxy
 	Archive          bool
+	ArchiveOptions   ArchiveOptions
+	archiveError     ArchiveErrorCallback
+	URLOptions       URLOptions
+	FileType         string
 	Compressed       bool
+	Compression      Compression
+	CompressionLevel int
+	AutoCompression  bool
+	PartSize         int64
+	KeepVersion      bool
+	Metadata         map[string]string
+	Dedup            DedupMode
+	ContentHash      string
+	RequestLimiter   *RateLimiter
+	progress         ProgressCallback
+	tracker          *progressTracker
+	generatedKey     bool
+	skipCompression  bool
+	part             bool
+	contentHash      string
 }
 
 // NewUploadRequest create a new uploadrequest
@@ -66,9 +81,93 @@ func (libdm LibDM) NewUploadRequest(name string, attributes FileAttributes) *Upl
 	}
 }
 
-// Compress the uploaded file
+// Compress the uploaded file using gzip
 func (uploadRequest *UploadRequest) Compress() *UploadRequest {
-	uploadRequest.Compressed = true
+	return uploadRequest.CompressWith(CompressionGzip, 0)
+}
+
+// CompressWith stores the uploaded file compressed using the
+// given algorithm. Level 0 uses the default level of the algorithm
+func (uploadRequest *UploadRequest) CompressWith(compression Compression, level int) *UploadRequest {
+	uploadRequest.Compression = compression
+	uploadRequest.CompressionLevel = level
+	uploadRequest.Compressed = compression != CompressionNone
+	return uploadRequest
+}
+
+// SkipIncompressible don't compress content which is compressed
+// already, detected by its mime type or its entropy
+func (uploadRequest *UploadRequest) SkipIncompressible() *UploadRequest {
+	uploadRequest.AutoCompression = true
+	return uploadRequest
+}
+
+// storedCompression returns the compression used to store the file
+func (uploadRequest *UploadRequest) storedCompression() Compression {
+	if uploadRequest.skipCompression {
+		return CompressionNone
+	}
+
+	// Compressed without algorithm means gzip
+	if uploadRequest.Compression == CompressionNone && uploadRequest.Compressed {
+		return CompressionGzip
+	}
+
+	return uploadRequest.Compression
+}
+
+// useTransportCompression returns true if the upload stream gets
+// compressed using gzip and decompressed by the server. Ciphertext
+// isn't compressible, so encrypted streams are sent as they are
+func (uploadRequest *UploadRequest) useTransportCompression() bool {
+	return !uploadRequest.skipCompression && uploadRequest.Encryption == 0 &&
+		uploadRequest.storedCompression() == CompressionNone
+}
+
+// pipelineOrder returns the order in which compression
+// and encryption get applied to the uploaded content
+func (uploadRequest *UploadRequest) pipelineOrder() PipelineOrder {
+	if uploadRequest.storedCompression() == CompressionNone {
+		return OrderNone
+	}
+
+	return OrderCompressEncrypt
+}
+
+// resolveCompression checks whether the content of r is worth compressing.
+// The returned reader has to be used instead of r
+func (uploadRequest *UploadRequest) resolveCompression(r io.Reader) (io.Reader, error) {
+	uploadRequest.skipCompression = false
+
+	if !IsValidCompression(uploadRequest.Compression) {
+		return nil, ErrCompressionNotSupported
+	}
+
+	if !uploadRequest.AutoCompression {
+		return r, nil
+	}
+
+	// Content gets compressed before encryption,
+	// so the plaintext sample is meaningful
+	r, sample, err := peekSample(r)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadRequest.skipCompression = IsIncompressible(sample)
+	return r, nil
+}
+
+// WithArchiveOptions sets the options used by UploadArchivedFolder
+func (uploadRequest *UploadRequest) WithArchiveOptions(options ArchiveOptions) *UploadRequest {
+	uploadRequest.ArchiveOptions = options
+	return uploadRequest
+}
+
+// OnArchiveError sets the callback receiving files which
+// were skipped by UploadArchivedFolder due to an error
+func (uploadRequest *UploadRequest) OnArchiveError(cb ArchiveErrorCallback) *UploadRequest {
+	uploadRequest.archiveError = cb
 	return uploadRequest
 }
 
@@ -78,6 +177,20 @@ func (uploadRequest *UploadRequest) SetFileSizeCallback(cb FileSizeCallback) *Up
 	return uploadRequest
 }
 
+// OnProgress sets the callback receiving progress events. The last
+// event has PhaseDone and contains the result of the upload
+func (uploadRequest *UploadRequest) OnProgress(cb ProgressCallback) *UploadRequest {
+	uploadRequest.progress = cb
+	return uploadRequest
+}
+
+// WithRateLimiter limits the bandwidth of this upload. The
+// limit of the LibDM applies as well
+func (uploadRequest *UploadRequest) WithRateLimiter(limiter *RateLimiter) *UploadRequest {
+	uploadRequest.RequestLimiter = limiter
+	return uploadRequest
+}
+
 // GetReaderProxy returns proxyReader for uploadRequest
 func (uploadRequest *UploadRequest) GetReaderProxy() ReaderProxy {
 	if uploadRequest.ProxyReader == nil {
@@ -131,6 +244,23 @@ func (uploadRequest *UploadRequest) ReplaceFileByID(fileID uint) *UploadRequest
 	return uploadRequest
 }
 
+// KeepPreviousVersion keep the replaced content as previous version
+// of the file instead of overwriting it
+func (uploadRequest *UploadRequest) KeepPreviousVersion() *UploadRequest {
+	uploadRequest.KeepVersion = true
+	return uploadRequest
+}
+
+// WithMetadata sets a metadata value of the uploaded file
+func (uploadRequest *UploadRequest) WithMetadata(key, value string) *UploadRequest {
+	if uploadRequest.Metadata == nil {
+		uploadRequest.Metadata = make(map[string]string)
+	}
+
+	uploadRequest.Metadata[key] = value
+	return uploadRequest
+}
+
 // Encrypted Upload a file encrypted
 func (uploadRequest *UploadRequest) Encrypted(encryptionMethod int8, key []byte) *UploadRequest {
 	uploadRequest.Encryption = encryptionMethod
@@ -140,6 +270,13 @@ func (uploadRequest *UploadRequest) Encrypted(encryptionMethod int8, key []byte)
 
 // BuildRequestStruct create a uploadRequset struct using Type
 func (uploadRequest *UploadRequest) BuildRequestStruct(Type UploadType) *UploadRequestStruct {
+	compression := uploadRequest.storedCompression()
+
+	var archiveFormat ArchiveFormat
+	if uploadRequest.Archive {
+		archiveFormat = uploadRequest.ArchiveOptions.GetFormat()
+	}
+
 	return &UploadRequestStruct{
 		UploadType:        Type,
 		Name:              uploadRequest.Name,
@@ -149,47 +286,172 @@ func (uploadRequest *UploadRequest) BuildRequestStruct(Type UploadType) *UploadR
 		PublicName:        uploadRequest.Publicname,
 		ReplaceFileByID:   uploadRequest.ReplaceFileID,
 		Archived:          uploadRequest.Archive,
-		Compressed:        uploadRequest.Compressed,
+		ArchiveFormat:     archiveFormat,
+		Compressed:        compression != CompressionNone,
+		Compression:       compression.storedName(),
+		Pipeline:          uploadRequest.pipelineOrder(),
 		All:               uploadRequest.All,
 		ReplaceEqualNames: uploadRequest.ReplaceEqualName,
+		KeepVersion:       uploadRequest.KeepVersion,
+		Metadata:          uploadRequest.Metadata,
+		ContentHash:       uploadRequest.contentHash,
+		Part:              uploadRequest.part,
+		FileType:          uploadRequest.FileType,
 	}
 }
 
-// UploadURL make a get request and forward the responsebody to a datavault upload
-func (uploadRequest UploadRequest) UploadURL(u *url.URL, uploadDone chan string, cancel chan bool) (*UploadResponse, error) {
-	if len(uploadRequest.Name) == 0 {
-		uploadRequest.Name = u.Hostname()
+// prepareKey generates a key for encrypted uploads without key if a
+// keystore is available. Fails before anything is uploaded if the
+// generated key couldn't be stored
+func (uploadRequest *UploadRequest) prepareKey() error {
+	if uploadRequest.Encryption == 0 || len(uploadRequest.EncryptionKey) > 0 || uploadRequest.Keystore == nil {
+		return nil
+	}
+
+	if uploadRequest.getKeystore().IsLocked() {
+		return ErrKeystoreLocked
+	}
+
+	// Reuse the key of a replaced file, otherwise
+	// older versions can't be decrypted anymore
+	replacedID, err := uploadRequest.replacedFileID()
+	if err != nil {
+		return err
+	}
+
+	if replacedID > 0 {
+		keystore := uploadRequest.getKeystore()
+		if file, err := keystore.GetKeyFile(replacedID); err == nil && file.Cipher == EncryptionCiphers[uploadRequest.Encryption] {
+			if key, err := keystore.GetKey(replacedID); err == nil {
+				uploadRequest.EncryptionKey = key
+				return nil
+			}
+		}
+	}
+
+	key, err := GenerateKey(uploadRequest.Encryption)
+	if err != nil {
+		return err
+	}
+
+	uploadRequest.EncryptionKey = key
+	uploadRequest.generatedKey = true
+	return nil
+}
+
+// replacedFileID returns the ID of the file replaced by the upload or 0.
+// Files replaced by name are only looked up if the server keeps their
+// versions, since the key of overwritten content isn't needed anymore
+func (uploadRequest *UploadRequest) replacedFileID() (uint, error) {
+	if uploadRequest.ReplaceFileID > 0 {
+		return uploadRequest.ReplaceFileID, nil
 	}
 
-	client := http.Client{}
+	if !uploadRequest.ReplaceEqualName || !uploadRequest.KeepVersion {
+		return 0, nil
+	}
 
-	// Build a new request
-	req, err := http.NewRequest("GET", u.String(), nil)
-	req.Header.Add("User-Agent", "curl")
+	resp, err := uploadRequest.NewFileQuery(uploadRequest.Attribute.Namespace).
+		WithName(uploadRequest.Name).
+		Do()
 	if err != nil {
+		return 0, err
+	}
+
+	for _, file := range resp.Files {
+		if file.Name == uploadRequest.Name {
+			return file.ID, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// storeKey saves a generated key in the keystore
+func (uploadRequest *UploadRequest) storeKey(resp *UploadResponse) error {
+	if !uploadRequest.generatedKey {
+		return nil
+	}
+
+	return uploadRequest.getKeystore().SaveKey(&KeystoreFile{
+		FileID:   resp.FileID,
+		Cipher:   EncryptionCiphers[uploadRequest.Encryption],
+		Checksum: resp.Checksum,
+	}, uploadRequest.EncryptionKey)
+}
+
+// UploadFromReader upload a file using r as data source. If the upload
+// is encrypted without a key and a keystore is set, a new key
+// gets generated and stored in the keystore
+func (uploadRequest *UploadRequest) UploadFromReader(r io.Reader, size int64, uploadDone chan string, cancel chan bool) (*UploadResponse, error) {
+	// Archived folders create the tracker on their own
+	if uploadRequest.tracker == nil {
+		uploadRequest.tracker = newProgressTracker(uploadRequest.progress, PhaseUploading, size)
+	}
+	defer func() {
+		uploadRequest.tracker = nil
+	}()
+
+	resp, err := uploadRequest.uploadFromReader(r, size, uploadDone, cancel)
+
+	// Send final progress event
+	var checksum string
+	if resp != nil {
+		checksum = resp.Checksum
+	}
+	uploadRequest.tracker.finish(checksum, err)
+
+	return resp, err
+}
+
+func (uploadRequest *UploadRequest) uploadFromReader(r io.Reader, size int64, uploadDone chan string, cancel chan bool) (*UploadResponse, error) {
+	// Skip upload if the content already exists
+	if resp, err := uploadRequest.deduplicate(r); err != nil || resp != nil {
+		if err == nil {
+			go func() {
+				uploadDone <- resp.Checksum
+			}()
+		}
+
+		return resp, err
+	}
+
+	// Generate key if required
+	if err := uploadRequest.prepareKey(); err != nil {
 		return nil, err
 	}
 
-	// Do the request
-	resp, err := client.Do(req)
+	var resp *UploadResponse
+	var err error
+
+	// Split big files into parts
+	if uploadRequest.PartSize > 0 && (size <= 0 || size > uploadRequest.PartSize) {
+		resp, err = uploadRequest.uploadParts(r, size, uploadDone, cancel)
+	} else {
+		resp, err = uploadRequest.uploadContent(r, size, uploadDone, cancel)
+	}
+
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Try to get the size to upload
-	size := int64(0)
-	length := resp.Header.Get("Content-Length")
-	if len(length) > 0 {
-		size, _ = strconv.ParseInt(length, 10, 64)
+	// Save generated key. The file is uploaded already, so
+	// return the response to allow handling the key manually
+	if err = uploadRequest.storeKey(resp); err != nil {
+		return resp, err
 	}
 
-	// Upload the responses body
-	return uploadRequest.UploadFromReader(resp.Body, size, uploadDone, cancel)
+	return resp, nil
 }
 
-// UploadFromReader upload a file using r as data source
-func (uploadRequest *UploadRequest) UploadFromReader(r io.Reader, size int64, uploadDone chan string, cancel chan bool) (*UploadResponse, error) {
+// uploadContent uploads the content of r as a single file
+func (uploadRequest *UploadRequest) uploadContent(r io.Reader, size int64, uploadDone chan string, cancel chan bool) (*UploadResponse, error) {
+	// Decide whether to compress
+	r, err := uploadRequest.resolveCompression(r)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build request and body
 	request := uploadRequest.BuildRequestStruct(FileUploadType)
 	body, contenttype, size := uploadRequest.UploadBodyBuilder(r, size, uploadDone, cancel)
@@ -203,12 +465,7 @@ func (uploadRequest *UploadRequest) UploadFromReader(r io.Reader, size int64, up
 		uploadRequest.fileSizeCallback(size)
 	}
 
-	resp, err := uploadRequest.Do(body, request, ContentType(contenttype))
-	if err != nil {
-		return nil, err
-	}
-
-	return resp, nil
+	return uploadRequest.Do(body, request, ContentType(contenttype))
 }
 
 // UploadFile uploads the given file to the server
@@ -225,17 +482,25 @@ func (uploadRequest *UploadRequest) UploadFile(f *os.File, uploadDone chan strin
 	return uploadRequest.UploadFromReader(f, fi.Size(), uploadDone, cancel)
 }
 
-// UploadArchivedFolder uploads the given folder to the server
+// UploadArchivedFolder uploads the given folder as archive to the
+// server. The archive gets created using the ArchiveOptions
 func (uploadRequest *UploadRequest) UploadArchivedFolder(uri string, uploadDone chan string, cancel chan bool) (*UploadResponse, error) {
 	uploadRequest.Archive = true
 
-	// Use size of all files in dir as
-	// full upload size
-	size, err := gaw.GetDirSize(uri)
+	folder, err := newFolderArchive(uri, uploadRequest.ArchiveOptions, uploadRequest.archiveError)
 	if err != nil {
 		return nil, err
 	}
 
+	// Use the size of the archive as upload size
+	size, err := folder.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	tracker := newProgressTracker(uploadRequest.progress, PhaseArchiving, size)
+	uploadRequest.tracker = tracker
+
 	errChan := make(chan error, 1)
 	doneChan := make(chan struct{}, 1)
 
@@ -243,11 +508,16 @@ func (uploadRequest *UploadRequest) UploadArchivedFolder(uri string, uploadDone
 	defer pr.Close()
 
 	go func() {
-		// Compress dir
-		if err := archive(uri, pw); err != nil {
+		// Archive dir
+		if err := folder.WriteTo(pw, tracker.setFile); err != nil {
 			errChan <- err
+			pw.CloseWithError(err)
+			return
 		}
-		defer pw.Close()
+
+		// Only the rest of the archive is left
+		tracker.setPhase(PhaseUploading)
+		pw.Close()
 	}()
 
 	var resp *UploadResponse
@@ -286,9 +556,9 @@ func (uploadRequest *UploadRequest) Do(body io.Reader, payload interface{}, cont
 	var resStruct UploadResponse
 	response, err := uploadRequest.NewRequest(EPFileUpload, body).
 		WithMethod(PUT).
-		// Negate the 'Compressed' field, to tell the server
-		// not to decompress the stream
-		WithCompression(!uploadRequest.Compressed).
+		// Tell the server to decompress the stream only
+		// if the file itself isn't stored compressed
+		WithCompression(uploadRequest.useTransportCompression()).
 		WithAuth(uploadRequest.Config.GetBearerAuth()).WithHeader(HeaderRequest, base64.StdEncoding.EncodeToString(rbody)).
 		WithRequestType(RawRequestType).
 		WithContentType(contentType).
@@ -301,10 +571,15 @@ func (uploadRequest *UploadRequest) Do(body io.Reader, payload interface{}, cont
 	return &resStruct, err
 }
 
-// UploadBodyBuilder build the body for the upload file request
+// UploadBodyBuilder build the body for the upload file request. The
+// body is throttled by the ratelimiters of the LibDM and the request
 func (uploadRequest *UploadRequest) UploadBodyBuilder(reader io.Reader, inpSize int64, doneChan chan string, cancel chan bool) (r *io.PipeReader, contentType string, size int64) {
+	// UploadFromReader resets the tracker of
+	// the request while the upload may still run
+	tracker := uploadRequest.tracker
+
 	// Apply readerproxy
-	reader = uploadRequest.GetReaderProxy()(reader)
+	reader = tracker.reader(uploadRequest.GetReaderProxy()(reader))
 	var err error
 
 	// Don't calculate a size if inputsize
@@ -329,19 +604,30 @@ func (uploadRequest *UploadRequest) UploadBodyBuilder(reader io.Reader, inpSize
 		// Create hashobject and use a multiwriter to
 		// write to the part and the hash at thes
 		var writer io.Writer
-		var gzipw *gzip.Writer
+		var compressor *gzip.Writer
 		hash := crc32.NewIEEE()
 
-		if uploadRequest.Compressed {
-			// Server uses gzip stream to build chehcksum
-			// Write zip stream into hash writer as well
-			gzipw = gzip.NewWriter(io.MultiWriter((uploadRequest.GetWriterProxy()(pW)), hash))
-			writer = gzipw
-		} else {
+		// Apply ratelimits to the upload stream
+		limited := uploadRequest.RateLimiter.Writer(uploadRequest.RequestLimiter.Writer(pW))
+		out := uploadRequest.GetWriterProxy()(limited)
+
+		if uploadRequest.useTransportCompression() {
 			// Server uses raw stream to build chehcksum, so put
 			// the hash writer separate
-			gzipw = gzip.NewWriter(uploadRequest.GetWriterProxy()(pW))
-			writer = io.MultiWriter(gzipw, hash)
+			compressor = gzip.NewWriter(out)
+			writer = io.MultiWriter(compressor, hash)
+		} else {
+			// Server uses the stored stream to build
+			// the checksum, so hash everything sent
+			writer = io.MultiWriter(out, hash)
+		}
+
+		// Compress the plaintext before encrypting it
+		source := reader
+		if compression := uploadRequest.storedCompression(); compression != CompressionNone {
+			compressed := compressReader(compression, uploadRequest.CompressionLevel, reader)
+			defer compressed.Close()
+			source = compressed
 		}
 
 		buf := make([]byte, uploadRequest.GetBuffersize())
@@ -350,31 +636,37 @@ func (uploadRequest *UploadRequest) UploadBodyBuilder(reader io.Reader, inpSize
 		// to support encryption
 		switch uploadRequest.Encryption {
 		case 1:
-			err = EncryptAES(writer, reader, uploadRequest.EncryptionKey, buf, cancel)
+			err = EncryptAES(writer, source, uploadRequest.EncryptionKey, buf, cancel)
 		case 2:
-			err = EncryptAGE(writer, reader, uploadRequest.EncryptionKey, buf, cancel)
+			err = EncryptAGE(writer, source, uploadRequest.EncryptionKey, buf, cancel)
 		case 0:
-			err = cancelledCopy(writer, reader, buf, cancel)
+			err = cancelledCopy(writer, source, buf, cancel)
 		}
 
 		var hsh string
-		if uploadRequest.Compressed {
-			// No server-side decompression will be executed
-			// so append hash to the end after full gzip stream
-			gzipw.Close()
-			hsh = hex.EncodeToString(hash.Sum(nil))
-			pW.Write([]byte(hsh))
-		} else {
+		switch {
+		case compressor != nil:
 			// Server wil decompress data
 			// so add hash to the end and gzip
 			// it as well
 			hsh = hex.EncodeToString(hash.Sum(nil))
 			writer.Write([]byte(hsh))
-			gzipw.Close()
+			compressor.Close()
+		default:
+			// No server-side decompression will be executed
+			// so append hash to the end of the stream
+			hsh = hex.EncodeToString(hash.Sum(nil))
+			pW.Write([]byte(hsh))
 		}
 
-		// Close everything and write into doneChan
+		// Server verifies the checksum now
+		if err != nil {
+			tracker.setErr(err)
+		} else {
+			tracker.setPhase(PhaseVerifying)
+		}
 
+		// Close everything and write into doneChan
 		if err != nil {
 			if err != ErrCancelled {
 				pW.CloseWithError(err)
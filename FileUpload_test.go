@@ -0,0 +1,208 @@
+package libdatamanager
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testHandler builds the response of a test server request
+type testHandler func(r *http.Request) interface{}
+
+// testStatus a response with an error status. An empty
+// body is sent as JSON encoded ErrorResponse
+type testStatus struct {
+	code int
+	body string
+}
+
+// newTestServer starts a server answering requests to the given endpoints
+// with their JSON encoded responses. testHandlers build the response
+func newTestServer(t *testing.T, responses map[Endpoint]interface{}) *LibDM {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[Endpoint(r.URL.Path)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if handler, ok := response.(testHandler); ok {
+			response = handler(r)
+		}
+
+		if status, ok := response.(testStatus); ok {
+			w.WriteHeader(status.code)
+			if len(status.body) > 0 {
+				io.WriteString(w, status.body)
+			} else {
+				json.NewEncoder(w).Encode(ErrorResponse{Message: http.StatusText(status.code)})
+			}
+			return
+		}
+
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewLibDM(&RequestConfig{
+		URL:      server.URL,
+		Username: "user",
+	})
+}
+
+func TestUploadPrepareKeyReusesReplacedKey(t *testing.T) {
+	libdm := newTestServer(t, map[Endpoint]interface{}{
+		EPFileList: FileListResponse{
+			Files: []FileResponseItem{{ID: 7, Name: "file"}},
+		},
+	})
+
+	store := newTestKeystore(t)
+	libdm.WithKeystore(store)
+
+	existing := []byte("0123456789abcdef0123456789abcdef")
+	if err := libdm.getKeystore().SaveKey(&KeystoreFile{
+		FileID: 7,
+		Cipher: EncryptionCiphers[1],
+	}, existing); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		replaceID uint
+		equalName bool
+		keep      bool
+		reuse     bool
+	}{
+		{name: "new file"},
+		{name: "replace by id", replaceID: 7, reuse: true},
+		{name: "replace by name", equalName: true},
+		{name: "replace by name keeping versions", equalName: true, keep: true, reuse: true},
+	}
+
+	for _, test := range tests {
+		request := libdm.NewUploadRequest("file", FileAttributes{})
+		request.Encryption = 1
+		request.ReplaceFileID = test.replaceID
+		request.ReplaceEqualName = test.equalName
+		request.KeepVersion = test.keep
+
+		if err := request.prepareKey(); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		reused := string(request.EncryptionKey) == string(existing)
+		if reused != test.reuse || request.generatedKey == test.reuse {
+			t.Errorf("%s: got reused %v (generated %v), want %v", test.name, reused, request.generatedKey, test.reuse)
+		}
+	}
+}
+
+func TestUploadArchivedFolderPhases(t *testing.T) {
+	dir := newTestFolder(t, map[string]string{
+		"a":     "a",
+		"dir/b": "b",
+	})
+
+	tests := []struct {
+		name       string
+		encryption int8
+	}{
+		{name: "plain"},
+		{name: "encrypted", encryption: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake, libdm := newFakeFileServer(t)
+
+			var phases []TransferPhase
+			var mx sync.Mutex
+			request := libdm.NewUploadRequest("folder.tar", FileAttributes{}).
+				OnProgress(func(event ProgressEvent) {
+					mx.Lock()
+					defer mx.Unlock()
+
+					if len(phases) == 0 || phases[len(phases)-1] != event.Phase {
+						phases = append(phases, event.Phase)
+					}
+				})
+
+			if test.encryption > 0 {
+				key, _ := GenerateKey(test.encryption)
+				request.Encrypted(test.encryption, key)
+			}
+
+			if _, err := request.UploadArchivedFolder(dir, make(chan string, 1), nil); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []TransferPhase{PhaseArchiving, PhaseUploading, PhaseVerifying, PhaseDone}
+
+			mx.Lock()
+			defer mx.Unlock()
+			if len(phases) != len(want) {
+				t.Fatalf("got phases %v, want %v", phases, want)
+			}
+
+			for i := range phases {
+				if phases[i] != want[i] {
+					t.Fatalf("got phases %v, want %v", phases, want)
+				}
+			}
+
+			if fake.count() != 1 {
+				t.Errorf("got %d uploaded files, want 1", fake.count())
+			}
+		})
+	}
+}
+
+func TestUploadLockedKeystore(t *testing.T) {
+	fake, libdm := newFakeFileServer(t)
+
+	store := newTestKeystore(t)
+	masterKey, err := GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetMasterKey(masterKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a fresh process
+	store.shared().masterKey = nil
+	libdm.WithKeystore(store)
+
+	tests := []struct {
+		name    string
+		key     []byte
+		wantErr error
+	}{
+		{name: "generated key", wantErr: ErrKeystoreLocked},
+		{name: "given key", key: []byte("0123456789abcdef0123456789abcdef")},
+	}
+
+	for _, test := range tests {
+		request := libdm.NewUploadRequest("file", FileAttributes{})
+		request.Encrypted(1, test.key)
+
+		uploaded := fake.count()
+		_, err := request.UploadFromReader(strings.NewReader("content"), 7, make(chan string, 1), nil)
+		if err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.wantErr)
+		}
+
+		if test.wantErr != nil && fake.count() != uploaded {
+			t.Errorf("%s: content uploaded without storing its key", test.name)
+		}
+	}
+}
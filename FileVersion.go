@@ -0,0 +1,47 @@
+package libdatamanager
+
+import "time"
+
+// ListFileVersions lists all versions of a file
+func (libdm LibDM) ListFileVersions(fileID uint) (*FileVersionListResponse, error) {
+	var response FileVersionListResponse
+
+	if _, err := libdm.Request(EPFileVersions, &FileVersionRequest{
+		FileID: fileID,
+	}, &response, true); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// RestoreFileVersion makes the given version the current version of
+// the file. The current content is kept as a new version
+func (libdm LibDM) RestoreFileVersion(fileID, version uint) (*UploadResponse, error) {
+	var response UploadResponse
+
+	if _, err := libdm.Request(EPFileVersionRestore, &FileVersionRequest{
+		FileID:  fileID,
+		Version: version,
+	}, &response, true); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// PruneFileVersions deletes old versions of a file. The newest keep versions
+// are kept. If olderThan is > 0, only versions older than it are deleted
+func (libdm LibDM) PruneFileVersions(fileID, keep uint, olderThan time.Duration) (*CountResponse, error) {
+	var response CountResponse
+
+	if _, err := libdm.Request(EPFileVersionPrune, &FileVersionRequest{
+		FileID:    fileID,
+		Keep:      keep,
+		OlderThan: int64(olderThan / time.Second),
+	}, &response, true); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
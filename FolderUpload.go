@@ -0,0 +1,215 @@
+package libdatamanager
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DefaultUploadWorkers default count of parallel uploads of a folder
+const DefaultUploadWorkers = 4
+
+// PathMapping how relative paths of files in an uploaded folder are mapped
+type PathMapping uint8
+
+// Path mappings
+const (
+	// PathAsPrefix prefix the filename with its relative
+	// path ("dir/sub/file.txt")
+	PathAsPrefix PathMapping = iota
+
+	// PathAsGroup use the relative directory as
+	// additional group ("dir/sub") and the base name
+	PathAsGroup
+
+	// PathIgnore use the base name only
+	PathIgnore
+)
+
+// FolderUploadOptions options for uploading a folder file by file
+type FolderUploadOptions struct {
+	Workers     int
+	PathMapping PathMapping
+}
+
+// FolderUploadResult result of uploading a single file of a folder
+type FolderUploadResult struct {
+	Path     string
+	Response *UploadResponse
+	Err      error
+}
+
+// FolderUploadReport results of uploading a folder
+type FolderUploadReport struct {
+	Uploaded []FolderUploadResult
+	Failed   []FolderUploadResult
+}
+
+// Err returns an error summarizing all failed uploads or nil
+func (report *FolderUploadReport) Err() error {
+	if len(report.Failed) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%d of %d uploads failed. First error: %s: %v",
+		len(report.Failed), len(report.Failed)+len(report.Uploaded), report.Failed[0].Path, report.Failed[0].Err)
+}
+
+// UploadFolder uploads every regular file inside uri as a separate file
+// using the settings of uploadRequest. Existing files are only replaced
+// if ReplaceEqualName is set. Unreadable directories are reported as
+// failed. cancel stops all running uploads
+func (uploadRequest *UploadRequest) UploadFolder(uri string, options FolderUploadOptions, cancel chan bool) (*FolderUploadReport, error) {
+	files, failed, err := listFolderFiles(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := options.Workers
+	if workers <= 0 {
+		workers = DefaultUploadWorkers
+	}
+
+	// Closing stop cancels all
+	// uploads at once
+	stop := make(chan bool)
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-cancel:
+			close(stop)
+		case <-finished:
+		}
+	}()
+	defer close(finished)
+
+	report := &FolderUploadReport{
+		Failed: failed,
+	}
+	var mx sync.Mutex
+	var wg sync.WaitGroup
+
+	jobs := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for file := range jobs {
+				var result FolderUploadResult
+
+				// Don't start uploads after cancelling
+				select {
+				case <-stop:
+					result = FolderUploadResult{Path: file, Err: ErrCancelled}
+				default:
+					result = uploadRequest.uploadFolderFile(uri, file, options.PathMapping, stop)
+				}
+
+				mx.Lock()
+				if result.Err != nil {
+					report.Failed = append(report.Failed, result)
+				} else {
+					report.Uploaded = append(report.Uploaded, result)
+				}
+				mx.Unlock()
+			}
+		}()
+	}
+
+	for _, file := range files {
+		select {
+		case <-stop:
+			mx.Lock()
+			report.Failed = append(report.Failed, FolderUploadResult{
+				Path: file,
+				Err:  ErrCancelled,
+			})
+			mx.Unlock()
+		case jobs <- file:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return report, nil
+}
+
+// uploadFolderFile uploads a single file of an uploaded folder
+func (uploadRequest *UploadRequest) uploadFolderFile(root, relPath string, mapping PathMapping, cancel chan bool) FolderUploadResult {
+	result := FolderUploadResult{
+		Path: relPath,
+	}
+
+	// Each file requires an own request
+	request := *uploadRequest
+	request.Attribute.Groups = append([]string{}, uploadRequest.Attribute.Groups...)
+	request.ReplaceFileID = 0
+	request.ContentHash = ""
+
+	slashPath := filepath.ToSlash(relPath)
+	dir, name := path.Split(slashPath)
+	dir = path.Clean(dir)
+
+	switch mapping {
+	case PathAsPrefix:
+		request.Name = slashPath
+	case PathAsGroup:
+		request.Name = name
+		if dir != "." {
+			request.Attribute.Groups = append(request.Attribute.Groups, dir)
+		}
+	default:
+		request.Name = name
+	}
+
+	f, err := os.Open(filepath.Join(root, relPath))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer f.Close()
+
+	done := make(chan string, 1)
+	result.Response, result.Err = request.UploadFile(f, done, cancel)
+	return result
+}
+
+// listFolderFiles returns the relative paths of all regular files in
+// root and the unreadable files and directories inside root
+func listFolderFiles(root string) ([]string, []FolderUploadResult, error) {
+	var files []string
+	var failed []FolderUploadResult
+
+	err := filepath.Walk(root, func(file string, fi os.FileInfo, err error) error {
+		rel, relErr := filepath.Rel(root, file)
+		if relErr != nil {
+			return relErr
+		}
+
+		if err != nil {
+			// The folder itself must be readable
+			if rel == "." {
+				return err
+			}
+
+			failed = append(failed, FolderUploadResult{
+				Path: rel,
+				Err:  err,
+			})
+			return nil
+		}
+
+		if fi.Mode().IsRegular() {
+			files = append(files, rel)
+		}
+
+		return nil
+	})
+
+	sort.Strings(files)
+	return files, failed, err
+}
@@ -0,0 +1,301 @@
+package libdatamanager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// requestedUpload decodes the upload request of r
+func requestedUpload(r *http.Request) UploadRequestStruct {
+	var request UploadRequestStruct
+	raw, _ := base64.StdEncoding.DecodeString(r.Header.Get(HeaderRequest))
+	json.Unmarshal(raw, &request)
+	return request
+}
+
+// resultPaths returns the sorted paths of results
+func resultPaths(results []FolderUploadResult) []string {
+	var paths []string
+	for _, result := range results {
+		paths = append(paths, filepath.ToSlash(result.Path))
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+func TestUploadFolderPathMapping(t *testing.T) {
+	files := map[string]string{
+		"a.txt":         "a",
+		"dir/b.txt":     "b",
+		"dir/sub/c.txt": "c",
+	}
+
+	tests := []struct {
+		name       string
+		mapping    PathMapping
+		wantNames  []string
+		wantGroups map[string]string // name -> added group
+	}{
+		{
+			name:      "prefix",
+			mapping:   PathAsPrefix,
+			wantNames: []string{"a.txt", "dir/b.txt", "dir/sub/c.txt"},
+		},
+		{
+			name:       "group",
+			mapping:    PathAsGroup,
+			wantNames:  []string{"a.txt", "b.txt", "c.txt"},
+			wantGroups: map[string]string{"b.txt": "dir", "c.txt": "dir/sub"},
+		},
+		{
+			name:      "ignore",
+			mapping:   PathIgnore,
+			wantNames: []string{"a.txt", "b.txt", "c.txt"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake, libdm := newFakeFileServer(t)
+			dir := newTestFolder(t, files)
+
+			request := libdm.NewUploadRequest("", FileAttributes{Namespace: "ns", Groups: []string{"base"}})
+			request.ReplaceFileWithSameName()
+
+			report, err := request.UploadFolder(dir, FolderUploadOptions{PathMapping: test.mapping}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := report.Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			fake.mx.Lock()
+			defer fake.mx.Unlock()
+
+			var names []string
+			for _, file := range fake.files {
+				names = append(names, file.request.Name)
+
+				wantGroups := []string{"base"}
+				if group, ok := test.wantGroups[file.request.Name]; ok {
+					wantGroups = append(wantGroups, group)
+				}
+
+				if strings.Join(file.request.Attributes.Groups, ",") != strings.Join(wantGroups, ",") {
+					t.Errorf("%s: got groups %v, want %v", file.request.Name, file.request.Attributes.Groups, wantGroups)
+				}
+
+				if file.request.Attributes.Namespace != "ns" {
+					t.Errorf("%s: got namespace %q, want ns", file.request.Name, file.request.Attributes.Namespace)
+				}
+
+				if !file.request.ReplaceEqualNames {
+					t.Errorf("%s: ReplaceEqualName not passed through", file.request.Name)
+				}
+			}
+
+			sort.Strings(names)
+			if strings.Join(names, ",") != strings.Join(test.wantNames, ",") {
+				t.Errorf("got names %v, want %v", names, test.wantNames)
+			}
+
+			// The groups of the request stay unchanged
+			if strings.Join(request.Attribute.Groups, ",") != "base" {
+				t.Errorf("got request groups %v, want [base]", request.Attribute.Groups)
+			}
+		})
+	}
+}
+
+func TestUploadFolderWorkers(t *testing.T) {
+	files := make(map[string]string)
+	for _, name := range []string{"1", "2", "3", "4", "5", "6", "7", "8"} {
+		files["dir/"+name] = name
+	}
+
+	tests := []struct {
+		workers    int
+		maxWorkers int
+	}{
+		{workers: 1, maxWorkers: 1},
+		{workers: 3, maxWorkers: 3},
+		{workers: 0, maxWorkers: DefaultUploadWorkers},
+	}
+
+	for _, test := range tests {
+		fake, libdm := newFakeFileServer(t)
+		dir := newTestFolder(t, files)
+
+		// Track parallel uploads
+		var mx sync.Mutex
+		var running, maxRunning int
+		fake.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+			mx.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mx.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mx.Lock()
+			running--
+			mx.Unlock()
+			return false
+		}
+
+		report, err := libdm.NewUploadRequest("", FileAttributes{}).UploadFolder(dir, FolderUploadOptions{Workers: test.workers}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(report.Uploaded) != len(files) || len(report.Failed) > 0 {
+			t.Errorf("%d workers: got %d uploaded and %d failed files, want %d uploaded", test.workers, len(report.Uploaded), len(report.Failed), len(files))
+		}
+
+		if fake.count() != len(files) {
+			t.Errorf("%d workers: got %d stored files, want %d", test.workers, fake.count(), len(files))
+		}
+
+		mx.Lock()
+		if maxRunning > test.maxWorkers || (test.maxWorkers > 1 && maxRunning < 2) {
+			t.Errorf("%d workers: got %d parallel uploads, want up to %d", test.workers, maxRunning, test.maxWorkers)
+		}
+		mx.Unlock()
+	}
+}
+
+func TestUploadFolderReport(t *testing.T) {
+	fake, libdm := newFakeFileServer(t)
+	dir := newTestFolder(t, map[string]string{
+		"ok.txt":        "ok",
+		"fail.txt":      "fail",
+		"dir/fail2.txt": "fail",
+		"dir/ok2.txt":   "ok",
+		"empty/":        "",
+	})
+
+	// Reject files named fail*
+	fake.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if !strings.HasPrefix(requestedUpload(r).Name, "fail") {
+			return false
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Message: "rejected"})
+		return true
+	}
+
+	report, err := libdm.NewUploadRequest("", FileAttributes{}).UploadFolder(dir, FolderUploadOptions{PathMapping: PathIgnore}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uploaded := resultPaths(report.Uploaded); strings.Join(uploaded, ",") != "dir/ok2.txt,ok.txt" {
+		t.Errorf("got uploaded files %v", uploaded)
+	}
+
+	if failed := resultPaths(report.Failed); strings.Join(failed, ",") != "dir/fail2.txt,fail.txt" {
+		t.Errorf("got failed files %v", failed)
+	}
+
+	for _, result := range report.Uploaded {
+		if result.Response == nil || result.Response.FileID == 0 {
+			t.Errorf("%s: got no upload response", result.Path)
+		}
+	}
+
+	if err := report.Err(); err == nil || !strings.HasPrefix(err.Error(), "2 of 4 uploads failed") {
+		t.Errorf("got error %v, want 2 of 4 failed uploads", err)
+	}
+}
+
+func TestUploadFolderUnreadableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read every directory")
+	}
+
+	fake, libdm := newFakeFileServer(t)
+	dir := newTestFolder(t, map[string]string{
+		"a.txt":          "a",
+		"locked/b.txt":   "b",
+		"readable/c.txt": "c",
+	})
+
+	locked := filepath.Join(dir, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	report, err := libdm.NewUploadRequest("", FileAttributes{}).UploadFolder(dir, FolderUploadOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failed := resultPaths(report.Failed); len(failed) != 1 || failed[0] != "locked" || !os.IsPermission(report.Failed[0].Err) {
+		t.Errorf("got failed paths %v (%v), want locked", failed, report.Err())
+	}
+
+	if len(report.Uploaded) != 2 || fake.count() != 2 {
+		t.Errorf("got %d uploaded files, want 2", len(report.Uploaded))
+	}
+}
+
+func TestUploadFolderCancel(t *testing.T) {
+	fake, libdm := newFakeFileServer(t)
+	dir := newTestFolder(t, map[string]string{
+		"1": "1", "2": "2", "3": "3", "4": "4", "5": "5", "6": "6",
+	})
+
+	// Hold the first uploads until cancelled
+	started := make(chan bool, 6)
+	release := make(chan bool)
+	fake.intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		started <- true
+		<-release
+		return false
+	}
+
+	cancel := make(chan bool, 1)
+	go func() {
+		<-started
+		<-started
+		cancel <- true
+
+		// Let the main loop see the cancellation
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+
+	report, err := libdm.NewUploadRequest("", FileAttributes{}).UploadFolder(dir, FolderUploadOptions{Workers: 2}, cancel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Uploaded) != 2 || fake.count() != 2 {
+		t.Errorf("got %d uploaded and %d stored files, want the 2 running uploads", len(report.Uploaded), fake.count())
+	}
+
+	if len(report.Failed) != 4 {
+		t.Fatalf("got %d failed files, want 4", len(report.Failed))
+	}
+
+	for _, result := range report.Failed {
+		if !errors.Is(result.Err, ErrCancelled) {
+			t.Errorf("%s: got error %v, want ErrCancelled", result.Path, result.Err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package libdatamanager
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileNames files containing gitignore style
+// patterns which get honoured while archiving folders
+var IgnoreFileNames = []string{".gitignore", ".dmignore"}
+
+// pathPattern a compiled gitignore style pattern
+type pathPattern struct {
+	regex   *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// compilePathPattern compiles a gitignore style pattern. Patterns
+// without a slash match the name at any depth, others are
+// relative to the directory containing the pattern
+func compilePathPattern(pattern string) (*pathPattern, error) {
+	p := &pathPattern{}
+
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	expr := "^"
+	if !anchored {
+		expr += "(.*/)?"
+	}
+	expr += globToRegex(pattern) + "$"
+
+	regex, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p.regex = regex
+	return p, nil
+}
+
+// globToRegex converts a glob supporting '**' into a regular expression
+func globToRegex(glob string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return sb.String()
+}
+
+// matches returns true if the slash separated path p matches
+func (pattern *pathPattern) matches(p string, isDir bool) bool {
+	if pattern.dirOnly && !isDir {
+		return false
+	}
+
+	return pattern.regex.MatchString(p)
+}
+
+// compilePathPatterns compiles all patterns
+func compilePathPatterns(patterns []string) ([]*pathPattern, error) {
+	compiled := make([]*pathPattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		p, err := compilePathPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		compiled = append(compiled, p)
+	}
+
+	return compiled, nil
+}
+
+// matchAny returns true if any pattern matches p
+func matchAny(patterns []*pathPattern, p string, isDir bool) bool {
+	for _, pattern := range patterns {
+		if pattern.matches(p, isDir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ignoreMatcher matches paths against the ignore
+// files found in the walked directories
+type ignoreMatcher struct {
+	root  string
+	rules map[string][]*pathPattern
+}
+
+// newIgnoreMatcher creates a new matcher for the folder root
+func newIgnoreMatcher(root string) *ignoreMatcher {
+	return &ignoreMatcher{
+		root:  root,
+		rules: make(map[string][]*pathPattern),
+	}
+}
+
+// load reads the ignore files of the directory
+// relDir, which is relative to the root
+func (matcher *ignoreMatcher) load(relDir string) error {
+	for _, name := range IgnoreFileNames {
+		f, err := os.Open(filepath.Join(matcher.root, filepath.FromSlash(relDir), name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return err
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimRight(scanner.Text(), " \t\r")
+			if len(line) == 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			pattern, err := compilePathPattern(line)
+			if err != nil {
+				f.Close()
+				return err
+			}
+
+			matcher.rules[relDir] = append(matcher.rules[relDir], pattern)
+		}
+
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ignored returns true if the slash separated path relPath is ignored.
+// Rules of deeper directories and later lines take precedence
+func (matcher *ignoreMatcher) ignored(relPath string, isDir bool) bool {
+	var ignored bool
+
+	// Collect all parent dirs from root to the deepest one
+	dirs := []string{"."}
+	for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+		dirs = append(dirs, "")
+		copy(dirs[2:], dirs[1:])
+		dirs[1] = dir
+	}
+
+	for _, dir := range dirs {
+		rel := relPath
+		if dir != "." {
+			rel = strings.TrimPrefix(relPath, dir+"/")
+		}
+
+		for _, rule := range matcher.rules[dir] {
+			if rule.matches(rel, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+
+	return ignored
+}
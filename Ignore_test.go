@@ -0,0 +1,94 @@
+package libdatamanager
+
+import (
+	"testing"
+)
+
+func TestPathPatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.log", "debug.log", false, true},
+		{"*.log", "logs/debug.log", false, true},
+		{"*.log", "debug.log.txt", false, false},
+		{"debug?.log", "debug1.log", false, true},
+		{"debug?.log", "debug10.log", false, false},
+		{"debug[0-9].log", "debug5.log", false, true},
+		{"debug[!0-9].log", "debug5.log", false, false},
+		{"debug[!0-9].log", "debuga.log", false, true},
+		{"/root.txt", "root.txt", false, true},
+		{"/root.txt", "sub/root.txt", false, false},
+		{"doc/*.txt", "doc/notes.txt", false, true},
+		{"doc/*.txt", "doc/sub/notes.txt", false, false},
+		{"doc/*.txt", "sub/doc/notes.txt", false, false},
+		{"doc/**/*.txt", "doc/sub/deep/notes.txt", false, true},
+		{"doc/**/*.txt", "doc/notes.txt", false, true},
+		{"**/build", "a/b/build", true, true},
+		{"**/build", "build", true, true},
+		{"logs/**", "logs/a/b", false, true},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		{"!keep.log", "keep.log", false, true},
+		{`\!important`, "!important", false, true},
+		{"a.b", "axb", false, false},
+		{"[unclosed", "[unclosed", false, true},
+	}
+
+	for _, test := range tests {
+		pattern, err := compilePathPattern(test.pattern)
+		if err != nil {
+			t.Errorf("%q: %v", test.pattern, err)
+			continue
+		}
+
+		if got := pattern.matches(test.path, test.isDir); got != test.want {
+			t.Errorf("%q matching %q (dir %v): got %v, want %v", test.pattern, test.path, test.isDir, got, test.want)
+		}
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	dir := newTestFolder(t, map[string]string{
+		".gitignore":          "*.log\nbuild/\n!keep.log\n",
+		"sub/.dmignore":       "/local.txt\n*.tmp\n",
+		"sub/deep/.gitignore": "!debug.log\n",
+	})
+
+	matcher := newIgnoreMatcher(dir)
+	for _, relDir := range []string{".", "sub", "sub/deep"} {
+		if err := matcher.load(relDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"debug.log", false, true},
+		{"keep.log", false, false},
+		{"sub/debug.log", false, true},
+		{"sub/deep/debug.log", false, false},
+		{"sub/deep/other.log", false, true},
+		{"build", true, true},
+		{"sub/build", true, true},
+		{"build", false, false},
+		{"sub/local.txt", false, true},
+		{"local.txt", false, false},
+		{"sub/deep/local.txt", false, false},
+		{"sub/deep/file.tmp", false, true},
+		{"file.tmp", false, false},
+		{"sub/file.txt", false, false},
+	}
+
+	for _, test := range tests {
+		if got := matcher.ignored(test.path, test.isDir); got != test.want {
+			t.Errorf("%s (dir %v): got ignored %v, want %v", test.path, test.isDir, got, test.want)
+		}
+	}
+}
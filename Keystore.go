@@ -1,11 +1,23 @@
 package libdatamanager
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
+	"github.com/JojiiOfficial/gaw"
 	"github.com/jinzhu/gorm"
 )
 
@@ -15,6 +27,9 @@ const (
 
 	// KeyringService the servicename for the keyring
 	KeyringService = "DataManagerCLI-keystore"
+
+	// KeystoreVersion the current schema version of the keystore db
+	KeystoreVersion = 2
 )
 
 // Errors
@@ -27,27 +42,107 @@ var (
 
 	// ErrKeyAlreadyexists error if keystore already contains an entry for the given fileid
 	ErrKeyAlreadyexists = errors.New("Keystore already contains given key")
+
+	// ErrKeystoreLocked error if the keystore is encrypted but wasn't unlocked
+	ErrKeystoreLocked = errors.New("Keystore is locked")
+
+	// ErrInvalidMasterKey error if the master key doesn't belong to the keystore
+	ErrInvalidMasterKey = errors.New("invalid master key")
 )
 
-// KeystoreFile the keystore row
+// keyfileMagic prefix of keyfiles encrypted with the master key
+var keyfileMagic = []byte("DMKEY1")
+
+// KeystoreFile the keystore row. A key is identified by
+// the server, the user and the fileID. Entries created by
+// an older keystore version have an empty ServerURL and Username
 type KeystoreFile struct {
 	gorm.Model
-	FileID uint
-	Key    string
+	ServerURL string `gorm:"index:idx_keystore_entry"`
+	Username  string `gorm:"index:idx_keystore_entry"`
+	FileID    uint   `gorm:"index:idx_keystore_entry"`
+	Key       string
+	Cipher    string
+	Checksum  string
 }
 
-// Keystore a place to store keys
+// KeystoreInfo stores information about the keystore itself.
+// KeyCheck is empty if the keystore isn't encrypted. DedupSecret
+// keys the content hashes of encrypted files
+type KeystoreInfo struct {
+	ID          uint `gorm:"primary_key"`
+	Version     uint
+	KeyCheck    string `gorm:"not null;default:''"`
+	DedupSecret string `gorm:"not null;default:''"`
+}
+
+// Keystore a place to store keys. Keys are looked up and
+// stored for ServerURL and Username, see WithServer
 type Keystore struct {
-	Path     string
-	DB       *gorm.DB
-	fileInfo os.FileInfo
+	Path      string
+	DB        *gorm.DB
+	ServerURL string
+	Username  string
+	state     *keystoreState
+}
+
+// keystoreState the state shared by a keystore and its views
+type keystoreState struct {
+	fileInfo  os.FileInfo
+	info      KeystoreInfo
+	masterKey []byte
+	mx        sync.Mutex
 }
 
 // NewKeystore create a new keystore
 func NewKeystore(path string) *Keystore {
 	return &Keystore{
-		Path: path,
+		Path:  path,
+		state: &keystoreState{},
+	}
+}
+
+// shared returns the state shared with all views of the keystore
+func (store *Keystore) shared() *keystoreState {
+	if store.state == nil {
+		store.state = &keystoreState{}
 	}
+
+	return store.state
+}
+
+// WithServer returns a view of the keystore which uses keys of the given
+// server and user only. The view shares the db and the unlocked master
+// key with store, which stays unchanged. Create views after calling Open
+func (store *Keystore) WithServer(serverURL, username string) *Keystore {
+	store.shared()
+
+	view := *store
+	view.ServerURL = NormalizeServerURL(serverURL)
+	view.Username = strings.ToLower(username)
+	return &view
+}
+
+// WithRequestConfig returns a view using server and user of the given config
+func (store *Keystore) WithRequestConfig(config *RequestConfig) *Keystore {
+	return store.WithServer(config.URL, config.Username)
+}
+
+// NormalizeServerURL returns the given url in a form which
+// can be used to compare server URLs
+func NormalizeServerURL(serverURL string) string {
+	u, err := url.Parse(strings.TrimSpace(serverURL))
+	if err != nil || len(u.Host) == 0 {
+		return strings.TrimRight(strings.ToLower(serverURL), "/")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	return u.String()
 }
 
 // GetKeystoreFile returns the full path of file
@@ -65,14 +160,15 @@ func (store *Keystore) Open() error {
 	var err error
 
 	// Get Info
-	store.fileInfo, err = os.Stat(store.Path)
+	state := store.shared()
+	state.fileInfo, err = os.Stat(store.Path)
 	if err != nil {
 		return err
 	}
 
 	// return error if given keystore
 	// path is not a dir
-	if !store.fileInfo.IsDir() {
+	if !state.fileInfo.IsDir() {
 		return ErrKeystoreNoDir
 	}
 
@@ -82,27 +178,337 @@ func (store *Keystore) Open() error {
 		return err
 	}
 
+	// SQLite allows a single writer only. Concurrent
+	// uploads would fail with "database is locked"
+	store.DB.DB().SetMaxOpenConns(1)
+
 	// Migrate DB
-	err = store.DB.AutoMigrate(&KeystoreFile{}).Error
+	return store.migrate()
+}
+
+// migrate updates the db schema to the current version
+func (store *Keystore) migrate() error {
+	// Keystores created before the info table existed
+	// already contain a keystore_files table
+	isLegacy := store.DB.HasTable(&KeystoreFile{}) && !store.DB.HasTable(&KeystoreInfo{})
+
+	err := store.DB.AutoMigrate(&KeystoreFile{}, &KeystoreInfo{}).Error
+	if err != nil {
+		return err
+	}
+
+	info := &store.shared().info
+	err = store.DB.FirstOrInit(info, KeystoreInfo{ID: 1}).Error
+	if err != nil {
+		return err
+	}
+
+	// Fresh keystores don't need any migration
+	if info.Version == 0 && !isLegacy {
+		info.Version = KeystoreVersion
+	}
+
+	// Version 1 -> 2: Columns added for server-aware
+	// entries are NULL for existing rows
+	if info.Version < 2 {
+		err = store.DB.Exec("UPDATE keystore_files SET server_url='' WHERE server_url IS NULL").Error
+		if err == nil {
+			err = store.DB.Exec("UPDATE keystore_files SET username='' WHERE username IS NULL").Error
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	info.Version = KeystoreVersion
+	return store.DB.Save(info).Error
+}
+
+// GenerateMasterKey generates a new random master key
+func GenerateMasterKey() ([]byte, error) {
+	return GenerateKey(1)
+}
+
+// IsEncrypted returns true if the keyfiles are encrypted using a master key
+func (store *Keystore) IsEncrypted() bool {
+	return len(store.shared().info.KeyCheck) > 0
+}
+
+// IsLocked returns true if the keystore is encrypted but not unlocked
+func (store *Keystore) IsLocked() bool {
+	return store.IsEncrypted() && store.shared().masterKey == nil
+}
+
+// keyCheck returns a value to verify masterKey with
+func keyCheck(masterKey []byte) string {
+	mac := hmac.New(sha256.New, masterKey)
+	mac.Write([]byte(KeyringService))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Unlock unlocks an encrypted keystore using masterKey
+func (store *Keystore) Unlock(masterKey []byte) error {
+	if !store.IsEncrypted() {
+		return nil
+	}
+
+	state := store.shared()
+	if !hmac.Equal([]byte(keyCheck(masterKey)), []byte(state.info.KeyCheck)) {
+		return ErrInvalidMasterKey
+	}
+
+	state.masterKey = masterKey
+	return nil
+}
+
+// UnlockWithShares reconstructs the master key from
+// the given shares and unlocks the keystore with it
+func (store *Keystore) UnlockWithShares(shares []SecretShare) error {
+	masterKey, err := CombineShares(shares)
+	if err != nil {
+		return err
+	}
+
+	return store.Unlock(masterKey)
+}
+
+// SplitMasterKey splits the master key of the unlocked keystore into n
+// shares. Any threshold of them can be used to reconstruct the master key
+func (store *Keystore) SplitMasterKey(n, threshold int) ([]SecretShare, error) {
+	if !store.IsEncrypted() {
+		return nil, errors.New("keystore is not encrypted")
+	}
+
+	if store.IsLocked() {
+		return nil, ErrKeystoreLocked
+	}
+
+	return SplitSecret(store.shared().masterKey, n, threshold)
+}
+
+// SetMasterKey re-encrypts all keyfiles using masterKey. If the keystore is
+// encrypted, it has to be unlocked. A nil masterKey decrypts the keystore.
+// If an error occurs, the keystore keeps using the old master key
+func (store *Keystore) SetMasterKey(masterKey []byte) error {
+	if store.IsLocked() {
+		return ErrKeystoreLocked
+	}
+
+	if masterKey != nil && len(masterKey) != 32 {
+		return ErrInvalidMasterKey
+	}
+
+	files, err := store.GetFiles()
+	if err != nil {
+		return err
+	}
+
+	// Read all keys before touching
+	// any file
+	keys := make(map[string][]byte)
+	for _, file := range files {
+		key, err := store.readKeyFile(file.Key)
+		if err != nil {
+			// Ignore invalid entries
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return err
+		}
+
+		keys[file.Key] = key
+	}
+
+	state := store.shared()
+	oldMasterKey := state.masterKey
+	oldKeyCheck := state.info.KeyCheck
+
+	// Write to temporary files first, which
+	// replace the keyfiles after the db change
+	removeTmp := func() {
+		for name := range keys {
+			os.Remove(store.GetKeystoreFile(name + ".tmp"))
+		}
+	}
+
+	for name, key := range keys {
+		if err = store.writeKeyFileWith(masterKey, name+".tmp", key); err != nil {
+			removeTmp()
+			return err
+		}
+	}
+
+	// Save the new key check
+	state.info.KeyCheck = ""
+	if masterKey != nil {
+		state.info.KeyCheck = keyCheck(masterKey)
+	}
+
+	if err = store.DB.Save(&state.info).Error; err != nil {
+		state.info.KeyCheck = oldKeyCheck
+		removeTmp()
+		return err
+	}
 
-	return err
+	var renamed []string
+	for name := range keys {
+		if err = os.Rename(store.GetKeystoreFile(name+".tmp"), store.GetKeystoreFile(name)); err != nil {
+			store.rollbackMasterKey(oldMasterKey, oldKeyCheck, renamed, keys)
+			removeTmp()
+			return err
+		}
+
+		renamed = append(renamed, name)
+	}
+
+	state.masterKey = masterKey
+	return nil
+}
+
+// rollbackMasterKey restores the keyfiles which were already
+// re-encrypted and the key check of the old master key
+func (store *Keystore) rollbackMasterKey(oldMasterKey []byte, oldKeyCheck string, renamed []string, keys map[string][]byte) {
+	for _, name := range renamed {
+		if store.writeKeyFileWith(oldMasterKey, name+".tmp", keys[name]) == nil {
+			os.Rename(store.GetKeystoreFile(name+".tmp"), store.GetKeystoreFile(name))
+		}
+	}
+
+	state := store.shared()
+	state.info.KeyCheck = oldKeyCheck
+	store.DB.Save(&state.info)
+}
+
+// DedupHash returns contentHash keyed with the dedup secret of the
+// keystore. Encrypted files are deduplicated using this hash, which
+// can't be used by the server to confirm their content
+func (store *Keystore) DedupHash(contentHash string) (string, error) {
+	secret, err := store.dedupSecret()
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(contentHash))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// dedupSecret returns the dedup secret and creates it if required
+func (store *Keystore) dedupSecret() ([]byte, error) {
+	state := store.shared()
+	state.mx.Lock()
+	defer state.mx.Unlock()
+
+	if len(state.info.DedupSecret) == 0 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+
+		state.info.DedupSecret = hex.EncodeToString(secret)
+		if err := store.DB.Save(&state.info).Error; err != nil {
+			state.info.DedupSecret = ""
+			return nil, err
+		}
+	}
+
+	return hex.DecodeString(state.info.DedupSecret)
+}
+
+// readKeyFile reads a keyfile and decrypts it if required
+func (store *Keystore) readKeyFile(name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(store.GetKeystoreFile(name))
+	if err != nil {
+		return nil, err
+	}
+
+	// Plain keyfile
+	if !bytes.HasPrefix(data, keyfileMagic) {
+		return data, nil
+	}
+
+	masterKey := store.shared().masterKey
+	if masterKey == nil {
+		return nil, ErrKeystoreLocked
+	}
+
+	gcm, err := newMasterKeyGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	data = data[len(keyfileMagic):]
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("keyfile too short")
+	}
+
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// writeKeyFile writes a keyfile and encrypts it if a master key is set
+func (store *Keystore) writeKeyFile(name string, key []byte) error {
+	return store.writeKeyFileWith(store.shared().masterKey, name, key)
+}
+
+// writeKeyFileWith writes a keyfile encrypted with masterKey, if not nil
+func (store *Keystore) writeKeyFileWith(masterKey []byte, name string, key []byte) error {
+	if masterKey != nil {
+		gcm, err := newMasterKeyGCM(masterKey)
+		if err != nil {
+			return err
+		}
+
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err = rand.Read(nonce); err != nil {
+			return err
+		}
+
+		data := append([]byte{}, keyfileMagic...)
+		data = append(data, nonce...)
+		key = gcm.Seal(data, nonce, key, nil)
+	}
+
+	return ioutil.WriteFile(store.GetKeystoreFile(name), key, 0600)
+}
+
+func newMasterKeyGCM(masterKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// scoped returns a query on db matching entries of the current server and user
+func (store *Keystore) scoped(db *gorm.DB, fileID uint) *gorm.DB {
+	return db.Model(&KeystoreFile{}).
+		Where("server_url=? AND username=? AND file_id=?", store.ServerURL, store.Username, fileID)
 }
 
 // HasKey check if keystore already contains given fileID
 func (store *Keystore) HasKey(fileID uint) (bool, error) {
 	var c int
 
-	err := store.DB.Model(&KeystoreFile{}).Where(&KeystoreFile{
-		FileID: fileID,
-	}).Limit(1).Count(&c).Error
+	err := store.scoped(store.DB, fileID).Limit(1).Count(&c).Error
 
 	return c > 0, err
 }
 
 // AddKey Inserts key into keystore
 func (store *Keystore) AddKey(fileID uint, keyPath string) error {
+	return store.AddKeyFile(&KeystoreFile{
+		FileID: fileID,
+		Key:    keyPath,
+	})
+}
+
+// AddKeyFile inserts a keystore entry into the keystore. ServerURL
+// and Username are set to the ones of the keystore
+func (store *Keystore) AddKeyFile(file *KeystoreFile) error {
 	// Check if key already exists
-	if has, err := store.HasKey(fileID); err != nil || has {
+	if has, err := store.HasKey(file.FileID); err != nil || has {
 		if err != nil {
 			return err
 		}
@@ -112,12 +518,89 @@ func (store *Keystore) AddKey(fileID uint, keyPath string) error {
 		}
 	}
 
-	// Create and insert key
-	_, keyFile := filepath.Split(keyPath)
-	return store.DB.Create(&KeystoreFile{
-		FileID: fileID,
-		Key:    keyFile,
-	}).Error
+	// Only store the filename of the key
+	_, file.Key = filepath.Split(file.Key)
+	file.ServerURL = store.ServerURL
+	file.Username = store.Username
+
+	return store.DB.Create(file).Error
+}
+
+// SaveKey writes key into a new keyfile inside the keystore and
+// inserts file. An existing entry for the same file is replaced. The
+// old key is kept if the new one can't be stored
+func (store *Keystore) SaveKey(file *KeystoreFile, key []byte) error {
+	if store.IsLocked() {
+		return ErrKeystoreLocked
+	}
+
+	// Write keyfile
+	file.Key = fmt.Sprintf("%d_%s.key", file.FileID, gaw.RandString(20))
+	if err := store.writeKeyFile(file.Key, key); err != nil {
+		return err
+	}
+
+	file.ServerURL = store.ServerURL
+	file.Username = store.Username
+
+	// Replace the entry of a replaced file
+	var old []KeystoreFile
+	err := store.DB.Transaction(func(tx *gorm.DB) error {
+		if err := store.scoped(tx, file.FileID).Find(&old).Error; err != nil {
+			return err
+		}
+
+		if len(old) > 0 {
+			if err := store.scoped(tx.Unscoped(), file.FileID).Delete(&KeystoreFile{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(file).Error
+	})
+
+	if err != nil {
+		os.Remove(store.GetKeystoreFile(file.Key))
+		return err
+	}
+
+	// The old keyfiles aren't referenced anymore
+	for _, oldFile := range old {
+		os.Remove(store.GetKeystoreFile(oldFile.Key))
+	}
+
+	return nil
+}
+
+// CopyKey assigns the key of sourceID to targetID as well
+func (store *Keystore) CopyKey(sourceID, targetID uint) error {
+	source, err := store.GetKeyFile(sourceID)
+	if err != nil {
+		return err
+	}
+
+	key, err := store.GetKey(sourceID)
+	if err != nil {
+		return err
+	}
+
+	return store.SaveKey(&KeystoreFile{
+		FileID:   targetID,
+		Cipher:   source.Cipher,
+		Checksum: source.Checksum,
+	}, key)
+}
+
+// ClaimLegacyKeys assigns all entries created by an older keystore
+// version to the current server and user. Legacy entries colliding
+// with an existing entry are left untouched
+func (store *Keystore) ClaimLegacyKeys() (int64, error) {
+	res := store.DB.Exec(`UPDATE keystore_files SET server_url=?, username=?
+		WHERE server_url='' AND username='' AND file_id NOT IN
+		(SELECT file_id FROM keystore_files WHERE server_url=? AND username=?)`,
+		store.ServerURL, store.Username, store.ServerURL, store.Username)
+
+	return res.RowsAffected, res.Error
 }
 
 // DeleteKey Inserts key into keystore
@@ -129,13 +612,14 @@ func (store *Keystore) DeleteKey(fileID uint) (*KeystoreFile, error) {
 	return file, store.DB.Unscoped().Delete(&file).Error
 }
 
-// GetKeyFile returns a keyfile with assigned to the fileID
+// GetKeyFile returns a keyfile with assigned to the fileID. Entries
+// created by an older keystore version are only found after
+// assigning them to a server using ClaimLegacyKeys
 func (store *Keystore) GetKeyFile(fileID uint) (*KeystoreFile, error) {
 	var storeFile KeystoreFile
 
 	// Find in db
-	err := store.DB.Model(&KeystoreFile{}).
-		Where("file_id=?", fileID).
+	err := store.scoped(store.DB, fileID).
 		Limit(1).
 		Find(&storeFile).Error
 
@@ -156,7 +640,7 @@ func (store *Keystore) GetKey(fileID uint) ([]byte, error) {
 	}
 
 	// Read keyfile
-	return ioutil.ReadFile(store.GetKeystoreFile(storefile.Key))
+	return store.readKeyFile(storefile.Key)
 }
 
 // GetFiles returns a slice containing all keystore Files
@@ -200,7 +684,7 @@ func (store *Keystore) GetKeyCount(validKeysOnly ...bool) (int, error) {
 
 // GetFileInfo returns fileinfo for the keystore
 func (store *Keystore) GetFileInfo() *os.FileInfo {
-	return &store.fileInfo
+	return &store.shared().fileInfo
 }
 
 // Close closes the keystore
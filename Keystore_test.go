@@ -0,0 +1,323 @@
+package libdatamanager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// newTestKeystore opens a keystore in a temporary directory
+func newTestKeystore(t *testing.T) *Keystore {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "dm-keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewKeystore(dir)
+	if err := store.Open(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		store.Close()
+		os.RemoveAll(dir)
+	})
+
+	return store
+}
+
+// saveTestKey stores key for fileID and fails the test on errors
+func saveTestKey(t *testing.T, store *Keystore, fileID uint, key string) {
+	t.Helper()
+
+	if err := store.SaveKey(&KeystoreFile{FileID: fileID}, []byte(key)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeystoreViews(t *testing.T) {
+	store := newTestKeystore(t)
+
+	serverA := store.WithServer("https://A.example.com/", "User")
+	serverB := store.WithServer("https://b.example.com", "user")
+
+	if len(store.ServerURL) > 0 || len(store.Username) > 0 {
+		t.Fatalf("WithServer changed the keystore to %s@%s", store.Username, store.ServerURL)
+	}
+
+	saveTestKey(t, serverA, 1, "key of a")
+	saveTestKey(t, serverB, 1, "key of b")
+
+	tests := []struct {
+		name  string
+		store *Keystore
+		want  string
+	}{
+		{"server a", serverA, "key of a"},
+		{"server b", serverB, "key of b"},
+		{"normalized url", store.WithServer("https://a.example.com", "user"), "key of a"},
+		{"other user", store.WithServer("https://a.example.com", "other"), ""},
+		{"no server", store, ""},
+	}
+
+	for _, test := range tests {
+		key, err := test.store.GetKey(1)
+		if len(test.want) == 0 {
+			if err == nil {
+				t.Errorf("%s: got key %q, want none", test.name, key)
+			}
+			continue
+		}
+
+		if err != nil || string(key) != test.want {
+			t.Errorf("%s: got key %q (%v), want %q", test.name, key, err, test.want)
+		}
+	}
+}
+
+func TestKeystoreViewsShareLockState(t *testing.T) {
+	store := newTestKeystore(t)
+
+	masterKey, err := GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SetMasterKey(masterKey); err != nil {
+		t.Fatal(err)
+	}
+
+	view := store.WithServer("https://a.example.com", "user")
+	saveTestKey(t, view, 1, "key")
+
+	// Simulate a fresh process
+	store.shared().masterKey = nil
+	if !view.IsLocked() {
+		t.Fatal("view isn't locked after locking the keystore")
+	}
+
+	if err := store.Unlock(masterKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if key, err := view.GetKey(1); err != nil || string(key) != "key" {
+		t.Errorf("got key %q (%v) after unlocking the keystore", key, err)
+	}
+}
+
+func TestKeystoreLegacyKeys(t *testing.T) {
+	store := newTestKeystore(t)
+
+	// Entries of older keystore versions have no server
+	saveTestKey(t, store, 1, "legacy key")
+	saveTestKey(t, store, 2, "legacy key 2")
+
+	serverA := store.WithServer("https://a.example.com", "user")
+	serverB := store.WithServer("https://b.example.com", "user")
+	saveTestKey(t, serverA, 2, "key of a")
+
+	if key, err := serverB.GetKey(1); err == nil {
+		t.Fatalf("got legacy key %q without claiming it", key)
+	}
+
+	n, err := serverA.ClaimLegacyKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("claimed %d keys, want 1", n)
+	}
+
+	tests := []struct {
+		name   string
+		store  *Keystore
+		fileID uint
+		want   string
+	}{
+		{"claimed", serverA, 1, "legacy key"},
+		{"existing entry kept", serverA, 2, "key of a"},
+		{"other server", serverB, 1, ""},
+		{"colliding legacy entry", store, 2, "legacy key 2"},
+	}
+
+	for _, test := range tests {
+		key, err := test.store.GetKey(test.fileID)
+		if len(test.want) == 0 {
+			if err == nil {
+				t.Errorf("%s: got key %q, want none", test.name, key)
+			}
+			continue
+		}
+
+		if err != nil || !bytes.Equal(key, []byte(test.want)) {
+			t.Errorf("%s: got key %q (%v), want %q", test.name, key, err, test.want)
+		}
+	}
+}
+
+func TestKeystoreSaveKeyReplaces(t *testing.T) {
+	store := newTestKeystore(t).WithServer("https://a.example.com", "user")
+
+	saveTestKey(t, store, 1, "old key")
+	old, err := store.GetKeyFile(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveTestKey(t, store, 1, "new key")
+
+	if key, err := store.GetKey(1); err != nil || string(key) != "new key" {
+		t.Errorf("got key %q (%v), want the new key", key, err)
+	}
+
+	if _, err := os.Stat(store.GetKeystoreFile(old.Key)); !os.IsNotExist(err) {
+		t.Errorf("old keyfile wasn't removed: %v", err)
+	}
+
+	if count, err := store.GetKeyCount(false); err != nil || count != 1 {
+		t.Errorf("got %d entries (%v), want 1", count, err)
+	}
+}
+
+func TestKeystoreSaveKeyLocked(t *testing.T) {
+	store := newTestKeystore(t)
+	view := store.WithServer("https://a.example.com", "user")
+
+	masterKey, err := GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SetMasterKey(masterKey); err != nil {
+		t.Fatal(err)
+	}
+
+	saveTestKey(t, view, 1, "old key")
+
+	store.shared().masterKey = nil
+	if err := view.SaveKey(&KeystoreFile{FileID: 1}, []byte("new key")); err != ErrKeystoreLocked {
+		t.Fatalf("got %v, want ErrKeystoreLocked", err)
+	}
+
+	if err := store.Unlock(masterKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if key, err := view.GetKey(1); err != nil || string(key) != "old key" {
+		t.Errorf("got key %q (%v), want the old key", key, err)
+	}
+}
+
+func TestKeystoreSetMasterKey(t *testing.T) {
+	firstKey, _ := GenerateMasterKey()
+	secondKey, _ := GenerateMasterKey()
+
+	tests := []struct {
+		name      string
+		oldKey    []byte
+		newKey    []byte
+		failSave  bool
+		wantKey   []byte
+		wantError bool
+	}{
+		{name: "encrypt", newKey: firstKey, wantKey: firstKey},
+		{name: "rotate", oldKey: firstKey, newKey: secondKey, wantKey: secondKey},
+		{name: "decrypt", oldKey: firstKey, wantKey: nil},
+		{name: "failed db save", oldKey: firstKey, newKey: secondKey, failSave: true, wantKey: firstKey, wantError: true},
+		{name: "failed first save", newKey: firstKey, failSave: true, wantKey: nil, wantError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newTestKeystore(t)
+			view := store.WithServer("https://a.example.com", "user")
+
+			if test.oldKey != nil {
+				if err := store.SetMasterKey(test.oldKey); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			saveTestKey(t, view, 1, "key 1")
+			saveTestKey(t, view, 2, "key 2")
+
+			if test.failSave {
+				store.DB.LogMode(false)
+				store.DB.Callback().Update().Before("gorm:update").Register("test:fail", func(scope *gorm.Scope) {
+					scope.Err(errors.New("save failed"))
+				})
+			}
+
+			err := store.SetMasterKey(test.newKey)
+			if (err != nil) != test.wantError {
+				t.Fatalf("got error %v, want error: %v", err, test.wantError)
+			}
+
+			if tmp, _ := filepath.Glob(store.GetKeystoreFile("*.tmp")); len(tmp) > 0 {
+				t.Errorf("temporary files left: %v", tmp)
+			}
+
+			// Simulate a fresh process
+			store.shared().masterKey = nil
+			if store.IsEncrypted() != (test.wantKey != nil) {
+				t.Fatalf("got encrypted %v, want %v", store.IsEncrypted(), test.wantKey != nil)
+			}
+
+			if test.wantKey != nil {
+				if err := store.Unlock(test.wantKey); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for fileID, want := range map[uint]string{1: "key 1", 2: "key 2"} {
+				if key, err := view.GetKey(fileID); err != nil || string(key) != want {
+					t.Errorf("file %d: got key %q (%v), want %q", fileID, key, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestKeystoreConcurrentSaveKey(t *testing.T) {
+	store := newTestKeystore(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := uint(1); i <= 50; i++ {
+		wg.Add(1)
+		go func(id uint) {
+			defer wg.Done()
+			errs <- store.SaveKey(&KeystoreFile{FileID: id}, []byte(fmt.Sprintf("key %d", id)))
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := store.GetFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 50 {
+		t.Errorf("got %d keys, want 50", len(files))
+	}
+}
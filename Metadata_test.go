@@ -0,0 +1,183 @@
+package libdatamanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUploadMetadata(t *testing.T) {
+	fake, libdm := newFakeFileServer(t)
+
+	tests := []struct {
+		name     string
+		metadata map[string]string
+	}{
+		{name: "none"},
+		{name: "single", metadata: map[string]string{"author": "me"}},
+		{name: "multiple", metadata: map[string]string{"author": "me", "source": "scanner"}},
+	}
+
+	for _, test := range tests {
+		request := libdm.NewUploadRequest(test.name, FileAttributes{})
+		for key, value := range test.metadata {
+			request.WithMetadata(key, value)
+		}
+
+		response, err := request.UploadFromReader(strings.NewReader("content"), 7, make(chan string, 1), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		fake.mx.Lock()
+		metadata := fake.files[response.FileID].request.Metadata
+		fake.mx.Unlock()
+
+		if len(metadata) != len(test.metadata) {
+			t.Errorf("%s: got metadata %v, want %v", test.name, metadata, test.metadata)
+			continue
+		}
+
+		for key, value := range test.metadata {
+			if metadata[key] != value {
+				t.Errorf("%s: got %s=%q, want %q", test.name, key, metadata[key], value)
+			}
+		}
+	}
+}
+
+func TestUpdateMetadata(t *testing.T) {
+	var request FileRequest
+	libdm := newTestServer(t, map[Endpoint]interface{}{
+		EPFileUpdate: testHandler(func(r *http.Request) interface{} {
+			request = FileRequest{}
+			json.NewDecoder(r.Body).Decode(&request)
+			return IDsResponse{IDs: []uint{request.FileID}}
+		}),
+	})
+
+	tests := []struct {
+		name       string
+		changes    FileChanges
+		wantSet    map[string]string
+		wantRemove []string
+	}{
+		{name: "unchanged", changes: FileChanges{NewName: "name"}},
+		{
+			name:    "set",
+			changes: FileChanges{SetMetadata: map[string]string{"author": "me"}},
+			wantSet: map[string]string{"author": "me"},
+		},
+		{
+			name:       "remove",
+			changes:    FileChanges{RemoveMetadata: []string{"author", "source"}},
+			wantRemove: []string{"author", "source"},
+		},
+		{
+			name: "set and remove",
+			changes: FileChanges{
+				SetMetadata:    map[string]string{"author": "you"},
+				RemoveMetadata: []string{"source"},
+			},
+			wantSet:    map[string]string{"author": "you"},
+			wantRemove: []string{"source"},
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := libdm.UpdateFile("", 1, "ns", false, test.changes); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		updates := request.Updates
+		if len(updates.SetMeta) != len(test.wantSet) {
+			t.Errorf("%s: got set metadata %v, want %v", test.name, updates.SetMeta, test.wantSet)
+		}
+
+		for key, value := range test.wantSet {
+			if updates.SetMeta[key] != value {
+				t.Errorf("%s: got %s=%q, want %q", test.name, key, updates.SetMeta[key], value)
+			}
+		}
+
+		if strings.Join(updates.RemoveMeta, ",") != strings.Join(test.wantRemove, ",") {
+			t.Errorf("%s: got removed metadata %v, want %v", test.name, updates.RemoveMeta, test.wantRemove)
+		}
+	}
+}
+
+func TestFileQueryMetadata(t *testing.T) {
+	files := []FileResponseItem{
+		{ID: 1, Metadata: map[string]string{"author": "me", "source": "scanner"}},
+		{ID: 2, Metadata: map[string]string{"author": "me"}},
+		{ID: 3, Metadata: map[string]string{"author": "you"}},
+		{ID: 4},
+	}
+
+	// Filter like the server does
+	libdm := newTestServer(t, map[Endpoint]interface{}{
+		EPFileList: testHandler(func(r *http.Request) interface{} {
+			var request FileListRequest
+			json.NewDecoder(r.Body).Decode(&request)
+
+			var response FileListResponse
+			for _, file := range files {
+				matches := true
+				if request.Filter != nil {
+					for key, value := range request.Filter.Metadata {
+						if file.Metadata[key] != value {
+							matches = false
+						}
+					}
+				}
+
+				if matches {
+					response.Files = append(response.Files, file)
+				}
+			}
+
+			return response
+		}),
+	})
+
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		want     []uint
+	}{
+		{name: "unfiltered", want: []uint{1, 2, 3, 4}},
+		{name: "single", metadata: map[string]string{"author": "me"}, want: []uint{1, 2}},
+		{name: "all values", metadata: map[string]string{"author": "me", "source": "scanner"}, want: []uint{1}},
+		{name: "no match", metadata: map[string]string{"author": "nobody"}},
+	}
+
+	for _, test := range tests {
+		query := libdm.NewFileQuery("ns")
+		for key, value := range test.metadata {
+			query.WithMetadata(key, value)
+		}
+
+		response, err := query.Do()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		var ids []uint
+		for _, file := range response.Files {
+			ids = append(ids, file.ID)
+		}
+
+		if len(ids) != len(test.want) {
+			t.Errorf("%s: got files %v, want %v", test.name, ids, test.want)
+			continue
+		}
+
+		for i := range ids {
+			if ids[i] != test.want[i] {
+				t.Errorf("%s: got files %v, want %v", test.name, ids, test.want)
+				break
+			}
+		}
+	}
+}
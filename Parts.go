@@ -0,0 +1,186 @@
+package libdatamanager
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// FilePart a part of a file which was split while uploading
+type FilePart struct {
+	FileID   uint   `json:"id"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// FileManifest links the parts of a split file. Size and
+// Checksum belong to the original content of the file
+type FileManifest struct {
+	Parts    []FilePart `json:"parts"`
+	Size     int64      `json:"size"`
+	Checksum string     `json:"checksum"`
+}
+
+// SplitInto uploads content bigger than partSize as multiple parts
+// which are linked by a manifest. The parts are hidden and the file
+// can be downloaded as usual. A partSize of 0 disables splitting
+func (uploadRequest *UploadRequest) SplitInto(partSize int64) *UploadRequest {
+	uploadRequest.PartSize = partSize
+	return uploadRequest
+}
+
+// uploadParts uploads r split into parts and creates the manifest
+func (uploadRequest *UploadRequest) uploadParts(r io.Reader, size int64, uploadDone chan string, cancel chan bool) (*UploadResponse, error) {
+	hash := crc32.NewIEEE()
+	reader := bufio.NewReader(io.TeeReader(r, hash))
+
+	// Report the size of the whole file instead of each part
+	if uploadRequest.fileSizeCallback != nil {
+		uploadRequest.fileSizeCallback(size)
+	}
+
+	var manifest FileManifest
+	for index := 0; ; index++ {
+		// Stop at the end of the stream
+		if _, err := reader.Peek(1); err != nil {
+			if err == io.EOF && index > 0 {
+				break
+			}
+
+			if err != io.EOF {
+				return nil, uploadRequest.abortParts(manifest, uploadDone, err)
+			}
+		}
+
+		partSize := uploadRequest.PartSize
+		if size > 0 && size-manifest.Size < partSize {
+			partSize = size - manifest.Size
+		}
+
+		// Each part is uploaded as hidden file
+		part := *uploadRequest
+		part.Name = fmt.Sprintf("%s.part%d", uploadRequest.Name, index)
+		part.part = true
+		part.Public = false
+		part.ReplaceFileID = 0
+		part.ReplaceEqualName = false
+		part.ContentHash = ""
+		part.contentHash = ""
+		part.fileSizeCallback = nil
+
+		if index > 0 {
+			uploadRequest.tracker.setPhase(PhaseUploading)
+		}
+
+		counter := &countingReader{
+			Reader: io.LimitReader(reader, uploadRequest.PartSize),
+		}
+
+		resp, err := part.uploadContent(counter, partSize, make(chan string, 1), cancel)
+		if err != nil {
+			return nil, uploadRequest.abortParts(manifest, uploadDone, err)
+		}
+
+		manifest.Parts = append(manifest.Parts, FilePart{
+			FileID:   resp.FileID,
+			Size:     counter.n,
+			Checksum: resp.Checksum,
+		})
+		manifest.Size += counter.n
+	}
+
+	manifest.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	request := uploadRequest.BuildRequestStruct(FileUploadType)
+	request.Manifest = &manifest
+
+	var resp UploadResponse
+	if _, err := uploadRequest.Request(EPFileManifest, request, &resp, true); err != nil {
+		return nil, uploadRequest.abortParts(manifest, uploadDone, err)
+	}
+
+	go func() {
+		uploadDone <- manifest.Checksum
+	}()
+
+	return &resp, nil
+}
+
+// abortParts deletes the uploaded parts and returns err
+func (uploadRequest *UploadRequest) abortParts(manifest FileManifest, uploadDone chan string, err error) error {
+	for _, part := range manifest.Parts {
+		uploadRequest.DeleteFile("", part.FileID, false, FileAttributes{
+			Namespace: uploadRequest.Attribute.Namespace,
+		}, true)
+	}
+
+	go func() {
+		uploadDone <- ""
+	}()
+
+	return err
+}
+
+// saveParts downloads all parts of a split file and writes them into w
+func (fileresponse *FileDownloadResponse) saveParts(w io.Writer, cancelChan chan bool, tracker *progressTracker) error {
+	request := fileresponse.DownloadRequest
+	hash := crc32.NewIEEE()
+	out := io.MultiWriter(tracker.writer(request.GetWriterProxy()(w)), hash)
+
+	// The checksum of the manifest can only be
+	// verified if the original content is restored
+	restored := true
+
+	for _, part := range fileresponse.Manifest.Parts {
+		partRequest := request.LibDM.NewFileRequestByID(part.FileID)
+		partRequest.Namespace = request.Namespace
+		partRequest.Decrypt = request.Decrypt
+		partRequest.Decompress = request.Decompress
+		partRequest.Key = request.Key
+		partRequest.Buffersize = request.Buffersize
+		partRequest.CancelDownload = request.CancelDownload
+		partRequest.ReaderProxy = request.ReaderProxy
+		partRequest.RequestLimiter = request.RequestLimiter
+
+		partResponse, err := partRequest.Do()
+		if err != nil {
+			return err
+		}
+		partResponse.Extract = fileresponse.Extract
+
+		if err := partResponse.SaveTo(out, cancelChan); err != nil {
+			return err
+		}
+
+		if !request.ignoreChecksum && !partResponse.VerifyChecksum() {
+			return ErrChecksumNotMatch
+		}
+
+		if (len(partResponse.Encryption) > 0 && !request.Decrypt) ||
+			(len(partResponse.Compression) > 0 && !fileresponse.Extract) {
+			restored = false
+		}
+	}
+
+	// All parts were verified on their own otherwise
+	fileresponse.LocalChecksum = fileresponse.ServerChecksum
+	if restored {
+		fileresponse.LocalChecksum = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	return nil
+}
+
+// countingReader counts the bytes read from Reader
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	reader.n += int64(n)
+	return n, err
+}
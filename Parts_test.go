@@ -0,0 +1,235 @@
+package libdatamanager
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeFile a file stored by the fakeFileServer
+type fakeFile struct {
+	request  UploadRequestStruct
+	content  []byte
+	checksum string
+}
+
+// fakeFileServer stores uploaded files in memory
+type fakeFileServer struct {
+	files map[uint]*fakeFile
+	next  uint
+	mx    sync.Mutex
+
+	// intercept handles requests instead of
+	// the fake if it returns true. Optional
+	intercept func(w http.ResponseWriter, r *http.Request) bool
+}
+
+// newFakeFileServer starts a fakeFileServer and returns a client for it
+func newFakeFileServer(t *testing.T) (*fakeFileServer, *LibDM) {
+	t.Helper()
+
+	fake := &fakeFileServer{
+		files: make(map[uint]*fakeFile),
+		next:  1,
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return fake, NewLibDM(&RequestConfig{
+		URL:      server.URL,
+		Username: "user",
+	})
+}
+
+func (fake *fakeFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if fake.intercept != nil && fake.intercept(w, r) {
+		return
+	}
+
+	fake.mx.Lock()
+	defer fake.mx.Unlock()
+
+	switch Endpoint(r.URL.Path) {
+	case EPFileUpload:
+		var request UploadRequestStruct
+		raw, _ := base64.StdEncoding.DecodeString(r.Header.Get(HeaderRequest))
+		json.Unmarshal(raw, &request)
+
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+
+		// The checksum is appended to the content
+		data, _ := ioutil.ReadAll(body)
+		fake.store(w, &fakeFile{
+			request:  request,
+			content:  data[:len(data)-8],
+			checksum: string(data[len(data)-8:]),
+		})
+	case EPFileManifest:
+		var request UploadRequestStruct
+		json.NewDecoder(r.Body).Decode(&request)
+
+		fake.store(w, &fakeFile{
+			request:  request,
+			checksum: request.Manifest.Checksum,
+		})
+	case EPFileDelete:
+		var request FileRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		delete(fake.files, request.FileID)
+		json.NewEncoder(w).Encode(IDsResponse{IDs: []uint{request.FileID}})
+	case EPFileGet:
+		var request FileRequest
+		json.NewDecoder(r.Body).Decode(&request)
+
+		file, ok := fake.files[request.FileID]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set(HeaderFileName, file.request.Name)
+		w.Header().Set(HeaderFileID, strconv.Itoa(int(request.FileID)))
+		w.Header().Set(HeaderChecksum, file.checksum)
+		w.Header().Set(HeaderCompression, string(file.request.Compression))
+		w.Header().Set(HeaderPipeline, string(file.request.Pipeline))
+		if file.request.Encryption > 0 {
+			w.Header().Set(HeaderEncryption, EncryptionCiphers[file.request.Encryption])
+		}
+
+		if file.request.Manifest != nil {
+			w.Header().Set(HeaderParts, strconv.Itoa(len(file.request.Manifest.Parts)))
+			json.NewEncoder(w).Encode(file.request.Manifest)
+			return
+		}
+
+		w.Write(file.content)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// store stores file and responds with its UploadResponse
+func (fake *fakeFileServer) store(w http.ResponseWriter, file *fakeFile) {
+	id := fake.next
+	fake.next++
+	fake.files[id] = file
+
+	json.NewEncoder(w).Encode(UploadResponse{
+		FileID:   id,
+		Filename: file.request.Name,
+		Checksum: file.checksum,
+		FileSize: int64(len(file.content)),
+	})
+}
+
+// count returns the count of stored files
+func (fake *fakeFileServer) count() int {
+	fake.mx.Lock()
+	defer fake.mx.Unlock()
+
+	return len(fake.files)
+}
+
+// parts returns the count of stored parts
+func (fake *fakeFileServer) parts() int {
+	fake.mx.Lock()
+	defer fake.mx.Unlock()
+
+	var parts int
+	for _, file := range fake.files {
+		if file.request.Part {
+			parts++
+		}
+	}
+
+	return parts
+}
+
+func TestSplitUpload(t *testing.T) {
+	content := make([]byte, 250000)
+	rand.New(rand.NewSource(1)).Read(content[:100000])
+
+	tests := []struct {
+		name        string
+		partSize    int64
+		encryption  int8
+		compression Compression
+		wantParts   int
+	}{
+		{name: "plain", partSize: 100000, wantParts: 3},
+		{name: "exact parts", partSize: 125000, wantParts: 2},
+		{name: "not split", partSize: 1000000, wantParts: 0},
+		{name: "compressed", partSize: 100000, compression: CompressionZstd, wantParts: 3},
+		{name: "encrypted", partSize: 100000, encryption: 1, compression: CompressionGzip, wantParts: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake, libdm := newFakeFileServer(t)
+
+			var key []byte
+			request := libdm.NewUploadRequest("file", FileAttributes{}).
+				SplitInto(test.partSize).
+				CompressWith(test.compression, 0)
+
+			if test.encryption > 0 {
+				key, _ = GenerateKey(test.encryption)
+				request.Encrypted(test.encryption, key)
+			}
+
+			var sizes []int64
+			request.SetFileSizeCallback(func(size int64) {
+				sizes = append(sizes, size)
+			})
+
+			resp, err := request.UploadFromReader(bytes.NewReader(content), int64(len(content)), make(chan string, 1), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(sizes) != 1 || sizes[0] != int64(len(content)) {
+				t.Errorf("got file sizes %v, want [%d]", sizes, len(content))
+			}
+
+			if parts := fake.parts(); parts != test.wantParts {
+				t.Errorf("got %d parts, want %d", parts, test.wantParts)
+			}
+
+			download, err := libdm.NewFileRequestByID(resp.FileID).DecryptWith(key).Do()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			if err := download.SaveTo(&out, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(out.Bytes(), content) {
+				t.Error("downloaded content differs")
+			}
+
+			if !download.VerifyChecksum() {
+				t.Error("checksum of the downloaded content doesn't match")
+			}
+		})
+	}
+}
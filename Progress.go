@@ -0,0 +1,255 @@
+package libdatamanager
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// ProgressInterval min interval between two progress events of the same phase
+const ProgressInterval = 100 * time.Millisecond
+
+// TransferPhase phase of an upload or download
+type TransferPhase string
+
+// Transfer phases
+const (
+	PhaseArchiving   TransferPhase = "archiving"
+	PhaseFetching    TransferPhase = "fetching"
+	PhaseUploading   TransferPhase = "uploading"
+	PhaseDownloading TransferPhase = "downloading"
+	PhaseDecrypting  TransferPhase = "decrypting"
+	PhaseVerifying   TransferPhase = "verifying"
+	PhaseDone        TransferPhase = "done"
+)
+
+// TransferResult the final result of a transfer. Err is
+// ErrCancelled if the transfer was cancelled
+type TransferResult struct {
+	Checksum string
+	Err      error
+}
+
+// ProgressEvent progress of a transfer. Done and Total count the bytes of
+// the source file (upload) or the received bytes (download). Total is 0 if
+// unknown. Result is only set in the last event, which has PhaseDone.
+// While archiving a folder, File is the file currently being archived
+// and FilesDone and FilesTotal count the files of the folder. Archives
+// are uploaded while being created, so Done counts the uploaded bytes
+// and PhaseUploading follows once all files are archived. While
+// fetching, Done counts the bytes fetched by the server
+type ProgressEvent struct {
+	Phase      TransferPhase
+	Done       int64
+	Total      int64
+	Rate       float64
+	ETA        time.Duration
+	File       string
+	FilesDone  int
+	FilesTotal int
+	Result     *TransferResult
+}
+
+// ProgressCallback gets called on progress of a transfer
+type ProgressCallback func(ProgressEvent)
+
+// progressTracker counts transferred bytes and
+// calls a ProgressCallback. A nil tracker does nothing
+type progressTracker struct {
+	callback   ProgressCallback
+	phase      TransferPhase
+	done       int64
+	total      int64
+	file       string
+	filesDone  int
+	filesTotal int
+	start      time.Time
+	last       time.Time
+	err        error
+	mx         sync.Mutex
+}
+
+// newProgressTracker returns a tracker calling callback or nil if callback is nil
+func newProgressTracker(callback ProgressCallback, phase TransferPhase, total int64) *progressTracker {
+	if callback == nil {
+		return nil
+	}
+
+	return &progressTracker{
+		callback: callback,
+		phase:    phase,
+		total:    total,
+		start:    time.Now(),
+	}
+}
+
+// add counts n transferred bytes
+func (tracker *progressTracker) add(n int) {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mx.Lock()
+	tracker.done += int64(n)
+
+	// Don't flood the callback
+	if time.Since(tracker.last) < ProgressInterval {
+		tracker.mx.Unlock()
+		return
+	}
+
+	tracker.emit(nil)
+}
+
+// setProgress replaces the counted bytes and the total, for
+// transfers which are reported instead of being counted
+func (tracker *progressTracker) setProgress(done, total int64) {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mx.Lock()
+	tracker.done = done
+	tracker.total = total
+
+	// Don't flood the callback
+	if time.Since(tracker.last) < ProgressInterval {
+		tracker.mx.Unlock()
+		return
+	}
+
+	tracker.emit(nil)
+}
+
+// setPhase switches to phase and emits an event
+func (tracker *progressTracker) setPhase(phase TransferPhase) {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mx.Lock()
+	tracker.phase = phase
+	tracker.emit(nil)
+}
+
+// setFile emits an event for each file of an archived folder
+func (tracker *progressTracker) setFile(name string, done, total int) {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mx.Lock()
+	tracker.file = name
+	tracker.filesDone = done
+	tracker.filesTotal = total
+	tracker.emit(nil)
+}
+
+// setErr remembers the error which stopped the transfer
+func (tracker *progressTracker) setErr(err error) {
+	if tracker == nil || err == nil {
+		return
+	}
+
+	tracker.mx.Lock()
+	if tracker.err == nil {
+		tracker.err = err
+	}
+	tracker.mx.Unlock()
+}
+
+// finish emits the final event. A previously set
+// error takes precedence over err
+func (tracker *progressTracker) finish(checksum string, err error) {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mx.Lock()
+	if tracker.err != nil {
+		err = tracker.err
+	}
+
+	if err != nil {
+		checksum = ""
+	}
+
+	tracker.phase = PhaseDone
+	tracker.emit(&TransferResult{
+		Checksum: checksum,
+		Err:      err,
+	})
+}
+
+// emit calls the callback. The mutex must be
+// locked and gets unlocked before calling it
+func (tracker *progressTracker) emit(result *TransferResult) {
+	event := ProgressEvent{
+		Phase:      tracker.phase,
+		Done:       tracker.done,
+		Total:      tracker.total,
+		File:       tracker.file,
+		FilesDone:  tracker.filesDone,
+		FilesTotal: tracker.filesTotal,
+		Result:     result,
+	}
+
+	// Calculate rate and eta
+	if elapsed := time.Since(tracker.start).Seconds(); elapsed > 0 {
+		event.Rate = float64(tracker.done) / elapsed
+	}
+	if event.Rate > 0 && tracker.total > tracker.done {
+		event.ETA = time.Duration(float64(tracker.total-tracker.done) / event.Rate * float64(time.Second))
+	}
+
+	tracker.last = time.Now()
+	tracker.mx.Unlock()
+
+	tracker.callback(event)
+}
+
+// reader returns a reader counting all bytes read from r
+func (tracker *progressTracker) reader(r io.Reader) io.Reader {
+	if tracker == nil {
+		return r
+	}
+
+	return &progressReader{
+		Reader:  r,
+		tracker: tracker,
+	}
+}
+
+// writer returns a writer counting all bytes written to w
+func (tracker *progressTracker) writer(w io.Writer) io.Writer {
+	if tracker == nil {
+		return w
+	}
+
+	return &progressWriter{
+		Writer:  w,
+		tracker: tracker,
+	}
+}
+
+type progressWriter struct {
+	io.Writer
+	tracker *progressTracker
+}
+
+func (writer *progressWriter) Write(p []byte) (int, error) {
+	n, err := writer.Writer.Write(p)
+	writer.tracker.add(n)
+	return n, err
+}
+
+type progressReader struct {
+	io.Reader
+	tracker *progressTracker
+}
+
+func (reader *progressReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	reader.tracker.add(n)
+	return n, err
+}
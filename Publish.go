@@ -0,0 +1,148 @@
+package libdatamanager
+
+import "time"
+
+// PublishOptions options for public links
+type PublishOptions struct {
+	// PublicName of the link. If empty, a random
+	// name will be created serverside
+	PublicName string
+
+	// Expires time after which the link is invalid.
+	// Zero means no expiration
+	Expires time.Time
+
+	// MaxDownloads count of allowed downloads.
+	// Zero means unlimited
+	MaxDownloads uint
+
+	// Password required to download the file
+	Password string
+}
+
+// ExpiresIn lets the link expire after d
+func (options PublishOptions) ExpiresIn(d time.Duration) PublishOptions {
+	options.Expires = time.Now().Add(d)
+	return options
+}
+
+// apply sets the options on the request
+func (options PublishOptions) apply(request *FileRequest) *FileRequest {
+	request.PublicName = options.PublicName
+	request.MaxDownloads = options.MaxDownloads
+	request.PublicPassword = options.Password
+
+	if !options.Expires.IsZero() {
+		request.Expires = &options.Expires
+	}
+
+	return request
+}
+
+// PublishFile publishs a file. If "all" is true, the response object is BulkPublishResponse. Else it is PublishResponse
+//
+// Deprecated: Use PublishFileWith or PublishFiles
+func (libdm LibDM) PublishFile(name string, id uint, publicName string, all bool, attributes FileAttributes) (interface{}, error) {
+	options := PublishOptions{
+		PublicName: publicName,
+	}
+
+	if all {
+		response, err := libdm.PublishFiles(attributes, options)
+		if err != nil {
+			return nil, err
+		}
+
+		return *response, nil
+	}
+
+	response, err := libdm.publishFile(name, id, attributes, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return *response, nil
+}
+
+// PublishFileWith publishs a single file using the given options
+func (libdm LibDM) PublishFileWith(name string, id uint, namespace string, options PublishOptions) (*PublishResponse, error) {
+	return libdm.publishFile(name, id, FileAttributes{
+		Namespace: namespace,
+	}, options)
+}
+
+// publishFile publishs the file matching name or id and attributes
+func (libdm LibDM) publishFile(name string, id uint, attributes FileAttributes, options PublishOptions) (*PublishResponse, error) {
+	var response PublishResponse
+
+	if _, err := libdm.Request(EPFilePublish, options.apply(&FileRequest{
+		Name:       name,
+		FileID:     id,
+		Attributes: attributes,
+	}), &response, true); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// PublishFiles publishs all files matching attributes using the given
+// options. options.PublicName is ignored since every file needs an own name
+func (libdm LibDM) PublishFiles(attributes FileAttributes, options PublishOptions) (*BulkPublishResponse, error) {
+	var response BulkPublishResponse
+
+	options.PublicName = ""
+	if _, err := libdm.Request(EPFilePublish, options.apply(&FileRequest{
+		All:        true,
+		Attributes: attributes,
+	}), &response, true); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// ListPublicFiles lists all public links of files in namespace
+func (libdm LibDM) ListPublicFiles(namespace string) (*PublicLinkListResponse, error) {
+	var response PublicLinkListResponse
+
+	if _, err := libdm.Request(EPFilePublicList, &FileRequest{
+		Attributes: FileAttributes{
+			Namespace: namespace,
+		},
+	}, &response, true); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// RevokePublicLink makes the file published under publicName private
+func (libdm LibDM) RevokePublicLink(publicName string) (*CountResponse, error) {
+	var response CountResponse
+
+	if _, err := libdm.Request(EPFileUnpublish, &FileRequest{
+		PublicName: publicName,
+	}, &response, true); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// RevokePublicLinks makes the given file or, if all is
+// true, all files matching attributes private
+func (libdm LibDM) RevokePublicLinks(name string, id uint, all bool, attributes FileAttributes) (*CountResponse, error) {
+	var response CountResponse
+
+	if _, err := libdm.Request(EPFileUnpublish, &FileRequest{
+		Name:       name,
+		FileID:     id,
+		All:        all,
+		Attributes: attributes,
+	}, &response, true); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
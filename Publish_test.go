@@ -0,0 +1,84 @@
+package libdatamanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestPublishFile(t *testing.T) {
+	var request FileRequest
+	libdm := newTestServer(t, map[Endpoint]interface{}{
+		EPFilePublish: testHandler(func(r *http.Request) interface{} {
+			request = FileRequest{}
+			json.NewDecoder(r.Body).Decode(&request)
+
+			if request.All {
+				return BulkPublishResponse{Files: []UploadResponse{{FileID: 1}, {FileID: 2}}}
+			}
+
+			return PublishResponse{PublicFilename: request.PublicName, FileID: request.FileID}
+		}),
+	})
+
+	attributes := FileAttributes{Namespace: "ns", Groups: []string{"group"}}
+
+	tests := []struct {
+		name    string
+		publish func() (interface{}, error)
+		want    string // type of the response
+		wantAll bool
+	}{
+		{
+			name: "deprecated single",
+			publish: func() (interface{}, error) {
+				return libdm.PublishFile("", 1, "public", false, attributes)
+			},
+			want: "libdatamanager.PublishResponse",
+		},
+		{
+			name: "deprecated all",
+			publish: func() (interface{}, error) {
+				return libdm.PublishFile("", 0, "public", true, attributes)
+			},
+			want:    "libdatamanager.BulkPublishResponse",
+			wantAll: true,
+		},
+		{
+			name: "with options",
+			publish: func() (interface{}, error) {
+				return libdm.PublishFileWith("", 1, "ns", PublishOptions{PublicName: "public", MaxDownloads: 3})
+			},
+			want: "*libdatamanager.PublishResponse",
+		},
+		{
+			name: "files",
+			publish: func() (interface{}, error) {
+				return libdm.PublishFiles(attributes, PublishOptions{PublicName: "ignored"})
+			},
+			want:    "*libdatamanager.BulkPublishResponse",
+			wantAll: true,
+		},
+	}
+
+	for _, test := range tests {
+		response, err := test.publish()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if got := fmt.Sprintf("%T", response); got != test.want {
+			t.Errorf("%s: got response of type %s, want %s", test.name, got, test.want)
+		}
+
+		if request.All != test.wantAll || request.Attributes.Namespace != "ns" {
+			t.Errorf("%s: got request %+v", test.name, request)
+		}
+
+		if test.wantAll && len(request.PublicName) > 0 {
+			t.Errorf("%s: public name %q sent for multiple files", test.name, request.PublicName)
+		}
+	}
+}
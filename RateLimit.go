@@ -0,0 +1,149 @@
+package libdatamanager
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// maxLimiterSleep max time to sleep at once. Keeps
+// limit changes effective during long waits
+const maxLimiterSleep = 100 * time.Millisecond
+
+// RateLimiter limits the bandwidth of transfers using a token bucket.
+// The limit can be changed while transfers are running
+type RateLimiter struct {
+	mx     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a new ratelimiter allowing bytesPerSec with the
+// given burst. If burst is <= 0, a burst of one second is used
+func NewRateLimiter(bytesPerSec, burst int64) *RateLimiter {
+	limiter := &RateLimiter{}
+	limiter.SetLimit(bytesPerSec, burst)
+	return limiter
+}
+
+// SetLimit changes the limit. A bytesPerSec value <= 0 disables the limit
+func (limiter *RateLimiter) SetLimit(bytesPerSec, burst int64) {
+	limiter.mx.Lock()
+	defer limiter.mx.Unlock()
+
+	if burst <= 0 {
+		burst = bytesPerSec
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+
+	limiter.rate = float64(bytesPerSec)
+	limiter.burst = float64(burst)
+	limiter.last = time.Now()
+	if limiter.tokens > limiter.burst {
+		limiter.tokens = limiter.burst
+	}
+}
+
+// Unlimited removes the limit
+func (limiter *RateLimiter) Unlimited() {
+	limiter.SetLimit(0, 0)
+}
+
+// Limit returns the current limit in bytes per second. 0 means unlimited
+func (limiter *RateLimiter) Limit() int64 {
+	limiter.mx.Lock()
+	defer limiter.mx.Unlock()
+
+	return int64(limiter.rate)
+}
+
+// wait blocks until n bytes may be transferred
+func (limiter *RateLimiter) wait(n int) {
+	remaining := float64(n)
+
+	for remaining > 0 {
+		limiter.mx.Lock()
+		if limiter.rate <= 0 {
+			limiter.mx.Unlock()
+			return
+		}
+
+		// Refill bucket
+		now := time.Now()
+		limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+		if limiter.tokens > limiter.burst {
+			limiter.tokens = limiter.burst
+		}
+		limiter.last = now
+
+		// Never take more than the bucket can hold
+		take := remaining
+		if take > limiter.burst {
+			take = limiter.burst
+		}
+
+		if limiter.tokens >= take {
+			limiter.tokens -= take
+			remaining -= take
+			limiter.mx.Unlock()
+			continue
+		}
+
+		sleep := time.Duration((take - limiter.tokens) / limiter.rate * float64(time.Second))
+		limiter.mx.Unlock()
+
+		if sleep > maxLimiterSleep {
+			sleep = maxLimiterSleep
+		}
+		time.Sleep(sleep)
+	}
+}
+
+// Reader returns a reader limited by limiter. If limiter is nil, r is returned
+func (limiter *RateLimiter) Reader(r io.Reader) io.Reader {
+	if limiter == nil {
+		return r
+	}
+
+	return &limitedReader{
+		Reader:  r,
+		limiter: limiter,
+	}
+}
+
+// Writer returns a writer limited by limiter. If limiter is nil, w is returned
+func (limiter *RateLimiter) Writer(w io.Writer) io.Writer {
+	if limiter == nil {
+		return w
+	}
+
+	return &limitedWriter{
+		Writer:  w,
+		limiter: limiter,
+	}
+}
+
+type limitedReader struct {
+	io.Reader
+	limiter *RateLimiter
+}
+
+func (reader *limitedReader) Read(p []byte) (int, error) {
+	n, err := reader.Reader.Read(p)
+	reader.limiter.wait(n)
+	return n, err
+}
+
+type limitedWriter struct {
+	io.Writer
+	limiter *RateLimiter
+}
+
+func (writer *limitedWriter) Write(p []byte) (int, error) {
+	writer.limiter.wait(len(p))
+	return writer.Writer.Write(p)
+}
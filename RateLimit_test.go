@@ -0,0 +1,140 @@
+package libdatamanager
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int64
+		burst   int64
+		size    int
+		writer  bool
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{name: "unlimited", size: 1 << 20, wantMax: 100 * time.Millisecond},
+		{name: "reader", limit: 1 << 20, size: 256 << 10, wantMin: 200 * time.Millisecond, wantMax: time.Second},
+		{name: "writer", limit: 1 << 20, size: 256 << 10, writer: true, wantMin: 200 * time.Millisecond, wantMax: time.Second},
+		{name: "small burst", limit: 1 << 20, burst: 1024, size: 256 << 10, wantMin: 200 * time.Millisecond, wantMax: time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewRateLimiter(test.limit, test.burst)
+			content := make([]byte, test.size)
+
+			start := time.Now()
+			if test.writer {
+				w := limiter.Writer(ioutil.Discard)
+				for i := 0; i < len(content); i += 32 << 10 {
+					if _, err := w.Write(content[i : i+32<<10]); err != nil {
+						t.Fatal(err)
+					}
+				}
+			} else if _, err := io.Copy(ioutil.Discard, limiter.Reader(bytes.NewReader(content))); err != nil {
+				t.Fatal(err)
+			}
+
+			elapsed := time.Since(start)
+			if elapsed < test.wantMin || elapsed > test.wantMax {
+				t.Errorf("took %v, want %v to %v", elapsed, test.wantMin, test.wantMax)
+			}
+		})
+	}
+}
+
+func TestRateLimiterChangedLimit(t *testing.T) {
+	limiter := NewRateLimiter(1024, 0)
+	if limiter.Limit() != 1024 {
+		t.Fatalf("got limit %d, want 1024", limiter.Limit())
+	}
+
+	// Lift the limit while the transfer waits
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		limiter.Unlimited()
+	}()
+
+	start := time.Now()
+	if _, err := io.Copy(ioutil.Discard, limiter.Reader(bytes.NewReader(make([]byte, 1<<20)))); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %v after lifting the limit", elapsed)
+	}
+
+	if limiter.Limit() != 0 {
+		t.Errorf("got limit %d, want unlimited", limiter.Limit())
+	}
+}
+
+func TestNilRateLimiter(t *testing.T) {
+	var limiter *RateLimiter
+
+	r := bytes.NewReader(nil)
+	if limiter.Reader(r) != io.Reader(r) {
+		t.Error("nil limiter wrapped the reader")
+	}
+
+	var w bytes.Buffer
+	if limiter.Writer(&w) != io.Writer(&w) {
+		t.Error("nil limiter wrapped the writer")
+	}
+}
+
+func TestUploadBodyRateLimit(t *testing.T) {
+	tests := []struct {
+		name         string
+		libdmLimit   int64
+		requestLimit int64
+		wantMin      time.Duration
+		wantMax      time.Duration
+	}{
+		{name: "unlimited", wantMax: 100 * time.Millisecond},
+		{name: "libdm", libdmLimit: 1 << 20, wantMin: 200 * time.Millisecond, wantMax: time.Second},
+		{name: "request", requestLimit: 1 << 20, wantMin: 200 * time.Millisecond, wantMax: time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			libdm := NewLibDM(&RequestConfig{})
+			if test.libdmLimit > 0 {
+				libdm.WithRateLimit(test.libdmLimit, 0)
+			}
+
+			request := libdm.NewUploadRequest("file", FileAttributes{})
+			if test.requestLimit > 0 {
+				request.WithRateLimiter(NewRateLimiter(test.requestLimit, 0))
+			}
+
+			// Read the body like a direct caller. Random
+			// content isn't shrunk by compression
+			content := make([]byte, 256<<10)
+			rand.Read(content)
+			body, _, _ := request.UploadBodyBuilder(bytes.NewReader(content), int64(len(content)), make(chan string, 1), nil)
+
+			start := time.Now()
+			n, err := io.Copy(ioutil.Discard, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if n < int64(len(content)) {
+				t.Errorf("got %d bytes, want at least %d", n, len(content))
+			}
+
+			elapsed := time.Since(start)
+			if elapsed < test.wantMin || elapsed > test.wantMax {
+				t.Errorf("took %v, want %v to %v", elapsed, test.wantMin, test.wantMax)
+			}
+		})
+	}
+}
@@ -52,15 +52,34 @@ const (
 	EPUserStats          = EPUser + "/stats"
 
 	// Files
-	EPFile        Endpoint = "/file"
-	EPFileList             = EPFile + "s"
-	EPFileUpdate           = EPFile + "/update"
-	EPFileDelete           = EPFile + "/delete"
-	EPFileGet              = "/download/file"
-	EPFilePublish          = EPFile + "/publish"
+	EPFile               Endpoint = "/file"
+	EPFileList                    = EPFile + "s"
+	EPFileUpdate                  = EPFile + "/update"
+	EPFileDelete                  = EPFile + "/delete"
+	EPFileGet                     = "/download/file"
+	EPFilePublish                 = EPFile + "/publish"
+	EPFileUnpublish               = EPFile + "/unpublish"
+	EPFilePublicList              = EPFile + "/public"
+	EPFileBatch                   = EPFile + "/batch"
+	EPFileCopy                    = EPFile + "/copy"
+	EPFileExists                  = EPFile + "/exists"
+	EPFileLink                    = EPFile + "/link"
+	EPFileVersion                 = EPFile + "/version"
+	EPFileVersions                = EPFileVersion + "s"
+	EPFileVersionRestore          = EPFileVersion + "/restore"
+	EPFileVersionPrune            = EPFileVersion + "/prune"
 
 	// Upload
-	EPFileUpload Endpoint = "/upload" + EPFile
+	EPFileUpload      Endpoint = "/upload" + EPFile
+	EPFileManifest    Endpoint = "/upload/manifest"
+	EPUploadURL       Endpoint = "/upload/url"
+	EPUploadJob       Endpoint = "/upload/job"
+	EPUploadJobCancel          = EPUploadJob + "/cancel"
+
+	// Trash
+	EPTrash        Endpoint = "/trash"
+	EPTrashRestore          = EPTrash + "/restore"
+	EPTrashPurge            = EPTrash + "/purge"
 
 	// Attribute
 	EPAttribute  Endpoint = "/attribute"
@@ -84,6 +103,9 @@ const (
 	EPNamespaceUpdate          = EPNamespace + "/update"
 	EPNamespaceDelete          = EPNamespace + "/delete"
 	EPNamespaceList            = EPNamespace + "s"
+
+	// Events
+	EPEvents Endpoint = "/events"
 )
 
 // RequestConfig configurations for requests
@@ -126,8 +148,36 @@ type FileListRequest struct {
 	OptionalParams OptionalRequetsParameter `json:"opt"`
 	Order          string                   `json:"order,omitempty"`
 	Attributes     FileAttributes           `json:"attributes"`
+	Filter         *FileFilter              `json:"filter,omitempty"`
+	Limit          uint                     `json:"limit,omitempty"`
+	Offset         uint                     `json:"offset,omitempty"`
+	Cursor         string                   `json:"cursor,omitempty"`
+	HideParts      bool                     `json:"hideparts,omitempty"`
+}
+
+// FileFilter additional filter for listing files
+type FileFilter struct {
+	NamePattern   string            `json:"namepattern,omitempty"`
+	MinSize       int64             `json:"minsize,omitempty"`
+	MaxSize       int64             `json:"maxsize,omitempty"`
+	CreatedAfter  *time.Time        `json:"after,omitempty"`
+	CreatedBefore *time.Time        `json:"before,omitempty"`
+	Encrypted     *bool             `json:"encr,omitempty"`
+	Public        *bool             `json:"pub,omitempty"`
+	TagMode       MatchMode         `json:"tagmode,omitempty"`
+	GroupMode     MatchMode         `json:"groupmode,omitempty"`
+	Metadata      map[string]string `json:"meta,omitempty"`
 }
 
+// MatchMode how multiple tags or groups are matched
+type MatchMode string
+
+// Match modes
+const (
+	MatchAny MatchMode = "any"
+	MatchAll MatchMode = "all"
+)
+
 // OptionalRequetsParameter optional request parameter
 type OptionalRequetsParameter struct {
 	Verbose uint8 `json:"verb"`
@@ -135,12 +185,55 @@ type OptionalRequetsParameter struct {
 
 // FileRequest contains data to update a file
 type FileRequest struct {
-	FileID     uint           `json:"fid"`
-	Name       string         `json:"name,omitempty"`
-	PublicName string         `json:"pubname,omitempty"`
-	Updates    FileUpdateItem `json:"updates,omitempty"`
-	All        bool           `json:"all"`
-	Attributes FileAttributes `json:"attributes"`
+	FileID         uint           `json:"fid"`
+	Name           string         `json:"name,omitempty"`
+	PublicName     string         `json:"pubname,omitempty"`
+	Updates        FileUpdateItem `json:"updates,omitempty"`
+	All            bool           `json:"all"`
+	Attributes     FileAttributes `json:"attributes"`
+	Expires        *time.Time     `json:"expires,omitempty"`
+	MaxDownloads   uint           `json:"maxdl,omitempty"`
+	PublicPassword string         `json:"pubpass,omitempty"`
+	Version        uint           `json:"version,omitempty"`
+	Permanent      bool           `json:"permanent,omitempty"`
+	OlderThan      int64          `json:"olderthan,omitempty"`
+}
+
+// FileCopyRequest request for copying files
+type FileCopyRequest struct {
+	FileID          uint              `json:"fid"`
+	Name            string            `json:"name,omitempty"`
+	All             bool              `json:"all"`
+	Attributes      FileAttributes    `json:"attributes"`
+	TargetNamespace string            `json:"targetns"`
+	NewName         string            `json:"newname,omitempty"`
+	Tags            []string          `json:"tags,omitempty"`
+	Groups          []string          `json:"groups,omitempty"`
+	TagMap          map[string]string `json:"tagmap,omitempty"`
+	GroupMap        map[string]string `json:"groupmap,omitempty"`
+	IsPublic        string            `json:"ispublic,omitempty"`
+	PublicName      string            `json:"pubname,omitempty"`
+}
+
+// FileVersionRequest request for managing versions of a file
+type FileVersionRequest struct {
+	FileID    uint  `json:"fid"`
+	Version   uint  `json:"version,omitempty"`
+	Keep      uint  `json:"keep,omitempty"`
+	OlderThan int64 `json:"olderthan,omitempty"`
+}
+
+// BatchRequest contains multiple operations on files
+type BatchRequest struct {
+	Operations []BatchOperation `json:"ops"`
+}
+
+// WatchRequest request for subscribing to events
+type WatchRequest struct {
+	Namespace     string      `json:"ns"`
+	AllNamespaces bool        `json:"allns"`
+	Cursor        string      `json:"cursor,omitempty"`
+	Types         []EventType `json:"types,omitempty"`
 }
 
 // UpdateAttributeRequest contains data to update a tag
@@ -176,16 +269,48 @@ type UploadRequestStruct struct {
 	Name       string     `json:"name"`
 
 	// Optional fields
-	URL               string         `json:"url,omitempty"`
-	Public            bool           `json:"pb,omitempty"`
-	PublicName        string         `json:"pbname,omitempty"`
-	Attributes        FileAttributes `json:"attr,omitempty"`
-	Encryption        int8           `json:"e,omitempty"`
-	Compressed        bool           `json:"compr,omitempty"`
-	Archived          bool           `json:"arved,omitempty"`
-	ReplaceFileByID   uint           `json:"r,omitempty"`
-	ReplaceEqualNames bool           `json:"ren"`
-	All               bool           `json:"a"`
+	URL               string            `json:"url,omitempty"`
+	Public            bool              `json:"pb,omitempty"`
+	PublicName        string            `json:"pbname,omitempty"`
+	Attributes        FileAttributes    `json:"attr,omitempty"`
+	Encryption        int8              `json:"e,omitempty"`
+	Compressed        bool              `json:"compr,omitempty"`
+	Compression       Compression       `json:"compression,omitempty"`
+	Pipeline          PipelineOrder     `json:"pipeline,omitempty"`
+	Archived          bool              `json:"arved,omitempty"`
+	ArchiveFormat     ArchiveFormat     `json:"arfmt,omitempty"`
+	ReplaceFileByID   uint              `json:"r,omitempty"`
+	ReplaceEqualNames bool              `json:"ren"`
+	All               bool              `json:"a"`
+	KeepVersion       bool              `json:"keepv,omitempty"`
+	Metadata          map[string]string `json:"meta,omitempty"`
+	ContentHash       string            `json:"hash,omitempty"`
+	Part              bool              `json:"part,omitempty"`
+	Manifest          *FileManifest     `json:"manifest,omitempty"`
+	FileType          string            `json:"ftype,omitempty"`
+
+	// Fields of URL uploads
+	URLHeaders map[string]string `json:"urlheaders,omitempty"`
+	URLMaxSize int64             `json:"urlmax,omitempty"`
+}
+
+// UploadJobRequest request for a server side upload job
+type UploadJobRequest struct {
+	JobID string `json:"id"`
+}
+
+// FileExistsRequest request for finding a file by its content hash
+type FileExistsRequest struct {
+	ContentHash string `json:"hash"`
+	Namespace   string `json:"ns"`
+	Encryption  int8   `json:"e"`
+}
+
+// FileLinkRequest request for creating a file using
+// the content of an existing one
+type FileLinkRequest struct {
+	SourceID uint                `json:"src"`
+	Upload   UploadRequestStruct `json:"upload"`
 }
 
 // StatsRequestStruct informations about a stat-request
@@ -403,10 +528,11 @@ func (request Request) Do(retVar interface{}) (*RestRequestResponse, error) {
 		if err != nil {
 			return nil, err
 		}
-		// Parse response into retVar
+		// Parse response into retVar. Keep the HTTP status
+		// of non JSON bodies, eg. returned by proxies
 		err = json.Unmarshal(d, &errRes)
 		if err != nil {
-			return nil, err
+			errRes.Message = http.StatusText(resp.StatusCode)
 		}
 
 		response.Message = fmt.Sprintf("%s", errRes.Message)
@@ -2,6 +2,7 @@ package libdatamanager
 
 import (
 	"net/http"
+	"time"
 )
 
 // ResponseStatus the status of response
@@ -44,6 +45,16 @@ const (
 
 	// HeaderChecksum files checksum
 	HeaderChecksum string = "Checksum"
+
+	// HeaderCompression compression of the stored file
+	HeaderCompression string = "X-Compression"
+
+	// HeaderPipeline order of compression and encryption
+	HeaderPipeline string = "X-Pipeline"
+
+	// HeaderParts count of parts of a split file. The
+	// body contains the manifest of the file if set
+	HeaderParts string = "X-Parts"
 )
 
 // LoginResponse response for login
@@ -70,9 +81,11 @@ type StringSliceResponse struct {
 	Slice []string `json:"slice"`
 }
 
-// FileListResponse response for listing files
+// FileListResponse response for listing files. If
+// NextCursor is empty, there are no more files
 type FileListResponse struct {
-	Files []FileResponseItem
+	Files      []FileResponseItem
+	NextCursor string `json:"cursor,omitempty"`
 }
 
 // UploadResponse response for uploading file
@@ -83,11 +96,53 @@ type UploadResponse struct {
 	Checksum       string `json:"checksum"`
 	FileSize       int64  `json:"size"`
 	Namespace      string `json:"ns"`
+
+	// Deduplicated is true if no content was
+	// uploaded since it already existed
+	Deduplicated bool `json:"-"`
+}
+
+// FileExistsResponse response for a file exists request
+type FileExistsResponse struct {
+	Exists bool           `json:"exists"`
+	File   UploadResponse `json:"file"`
 }
 
 // PublishResponse response for publishing a file
 type PublishResponse struct {
-	PublicFilename string `json:"pubName"`
+	PublicFilename    string     `json:"pubName"`
+	FileID            uint       `json:"fileID,omitempty"`
+	Expires           *time.Time `json:"expires,omitempty"`
+	MaxDownloads      uint       `json:"maxdl,omitempty"`
+	PasswordProtected bool       `json:"pwprotected,omitempty"`
+}
+
+// PublicLink a public link of a file
+type PublicLink struct {
+	FileID            uint       `json:"fileID"`
+	Filename          string     `json:"filename"`
+	Namespace         string     `json:"ns"`
+	PublicFilename    string     `json:"pubName"`
+	Created           time.Time  `json:"created"`
+	Expires           *time.Time `json:"expires,omitempty"`
+	MaxDownloads      uint       `json:"maxdl,omitempty"`
+	Downloads         uint       `json:"downloads"`
+	PasswordProtected bool       `json:"pwprotected,omitempty"`
+}
+
+// IsExpired returns true if the link expired or
+// reached its download limit
+func (link PublicLink) IsExpired() bool {
+	if link.Expires != nil && time.Now().After(*link.Expires) {
+		return true
+	}
+
+	return link.MaxDownloads > 0 && link.Downloads >= link.MaxDownloads
+}
+
+// PublicLinkListResponse response for listing public files
+type PublicLinkListResponse struct {
+	Links []PublicLink `json:"links"`
 }
 
 // BulkPublishResponse response for publishing a file
@@ -100,11 +155,101 @@ type CountResponse struct {
 	Count uint32 `json:"count"`
 }
 
+// UploadJobState state of a server side upload job
+type UploadJobState string
+
+// Upload job states
+const (
+	UploadJobPending   UploadJobState = "pending"
+	UploadJobRunning   UploadJobState = "running"
+	UploadJobDone      UploadJobState = "done"
+	UploadJobFailed    UploadJobState = "failed"
+	UploadJobCancelled UploadJobState = "cancelled"
+)
+
+// UploadJobResponse response for submitting a server side upload job
+type UploadJobResponse struct {
+	JobID string `json:"id"`
+}
+
+// UploadJobStatus status of a server side upload job. Size is 0 if
+// unknown and Upload is only set if the job is done
+type UploadJobStatus struct {
+	JobID        string          `json:"id"`
+	State        UploadJobState  `json:"state"`
+	BytesFetched int64           `json:"fetched"`
+	Size         int64           `json:"size,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	Upload       *UploadResponse `json:"upload,omitempty"`
+}
+
 // IDsResponse response containing a list of ids
 type IDsResponse struct {
 	IDs []uint `json:"ids"`
 }
 
+// CopyResponse response for copying files
+type CopyResponse struct {
+	Files []CopiedFile `json:"files"`
+}
+
+// CopiedFile a file created by copying SourceID
+type CopiedFile struct {
+	SourceID  uint   `json:"src"`
+	FileID    uint   `json:"fileID"`
+	Filename  string `json:"filename"`
+	Namespace string `json:"ns"`
+}
+
+// IDs returns the IDs of the new files
+func (response CopyResponse) IDs() []uint {
+	ids := make([]uint, len(response.Files))
+	for i := range response.Files {
+		ids[i] = response.Files[i].FileID
+	}
+
+	return ids
+}
+
+// TrashItem a file in the trash
+type TrashItem struct {
+	FileResponseItem
+	DeletedAt time.Time `json:"deleted"`
+}
+
+// TrashListResponse response for listing the trash
+type TrashListResponse struct {
+	Files []TrashItem `json:"files"`
+}
+
+// FileVersion a version of a file
+type FileVersion struct {
+	Version      uint      `json:"version"`
+	Size         int64     `json:"size"`
+	Checksum     string    `json:"checksum"`
+	CreationDate time.Time `json:"creation"`
+	Encryption   int8      `json:"e"`
+	IsCurrent    bool      `json:"current"`
+}
+
+// FileVersionListResponse response for listing versions of a file
+type FileVersionListResponse struct {
+	FileID   uint          `json:"fileID"`
+	Versions []FileVersion `json:"versions"`
+}
+
+// BatchResponse response for a batch request
+type BatchResponse struct {
+	Results []BatchResultItem `json:"results"`
+}
+
+// BatchResultItem result of a single batch operation. Index
+// is the index of the operation in the request
+type BatchResultItem struct {
+	Index int    `json:"i"`
+	Error string `json:"error,omitempty"`
+}
+
 // UserAttributeDataResponse response for userattribute data
 type UserAttributeDataResponse struct {
 	Namespace []Namespaceinfo `json:"nsData"`
@@ -0,0 +1,231 @@
+package libdatamanager
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// SecretSharePrefix prefix of a printable secret share
+const SecretSharePrefix = "dmshare1"
+
+var (
+	// ErrInvalidShareParams error if the share count or threshold is invalid
+	ErrInvalidShareParams = errors.New("threshold must be between 2 and the share count, shares must be at most 255")
+
+	// ErrInvalidShare error if a share is malformed
+	ErrInvalidShare = errors.New("invalid secret share")
+
+	// ErrShareMismatch error if shares don't belong to the same secret
+	ErrShareMismatch = errors.New("shares don't belong to the same secret")
+
+	// ErrNotEnoughShares error if less shares than the threshold were given
+	ErrNotEnoughShares = errors.New("not enough shares to reconstruct the secret")
+)
+
+// SecretShare one share of a secret split using shamir's secret sharing
+type SecretShare struct {
+	Index     uint8
+	Threshold uint8
+	SecretID  string
+	Data      []byte
+}
+
+// Log and exp tables for GF(2^8) using the AES polynomial
+var gfLog, gfExp [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = byte(i)
+
+		// Multiply by the generator 3
+		x ^= gfDouble(x)
+	}
+	gfExp[255] = gfExp[0]
+}
+
+func gfDouble(x byte) byte {
+	if x&0x80 != 0 {
+		return (x << 1) ^ 0x1b
+	}
+
+	return x << 1
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return gfExp[(int(gfLog[a])+int(gfLog[b]))%255]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+
+	return gfExp[(int(gfLog[a])-int(gfLog[b])+255)%255]
+}
+
+// secretID returns a short fingerprint of secret
+// used to detect shares of different secrets
+func secretID(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:4])
+}
+
+// SplitSecret splits secret into n shares. Any threshold
+// shares can be used to reconstruct the secret
+func SplitSecret(secret []byte, n, threshold int) ([]SecretShare, error) {
+	if threshold < 2 || threshold > n || n > 255 {
+		return nil, ErrInvalidShareParams
+	}
+
+	if len(secret) == 0 {
+		return nil, errors.New("secret is empty")
+	}
+
+	id := secretID(secret)
+	shares := make([]SecretShare, n)
+	for i := range shares {
+		shares[i] = SecretShare{
+			Index:     uint8(i + 1),
+			Threshold: uint8(threshold),
+			SecretID:  id,
+			Data:      make([]byte, len(secret)),
+		}
+	}
+
+	// One random polynomial for each byte of the
+	// secret with the secret byte as constant term
+	coeffs := make([]byte, threshold)
+	for i, b := range secret {
+		coeffs[0] = b
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+
+		for j := range shares {
+			shares[j].Data[i] = evalPolynomial(coeffs, shares[j].Index)
+		}
+	}
+
+	return shares, nil
+}
+
+// evalPolynomial evaluates the polynomial at x using horner's method
+func evalPolynomial(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+
+	return y
+}
+
+// CombineShares reconstructs the secret from the given shares
+func CombineShares(shares []SecretShare) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrNotEnoughShares
+	}
+
+	// Validate shares
+	first := shares[0]
+	seen := make(map[uint8]bool)
+	for _, share := range shares {
+		if share.Index == 0 || len(share.Data) == 0 {
+			return nil, ErrInvalidShare
+		}
+
+		if share.Threshold != first.Threshold || share.SecretID != first.SecretID || len(share.Data) != len(first.Data) {
+			return nil, ErrShareMismatch
+		}
+
+		if seen[share.Index] {
+			return nil, fmt.Errorf("duplicate share %d", share.Index)
+		}
+		seen[share.Index] = true
+	}
+
+	if len(shares) < int(first.Threshold) {
+		return nil, ErrNotEnoughShares
+	}
+	shares = shares[:first.Threshold]
+
+	// Lagrange interpolation at x=0
+	secret := make([]byte, len(first.Data))
+	for i, share := range shares {
+		basis := byte(1)
+		for j, other := range shares {
+			if i == j {
+				continue
+			}
+
+			basis = gfMul(basis, gfDiv(other.Index, other.Index^share.Index))
+		}
+
+		for k := range secret {
+			secret[k] ^= gfMul(share.Data[k], basis)
+		}
+	}
+
+	// Verify the result
+	if secretID(secret) != first.SecretID {
+		return nil, ErrShareMismatch
+	}
+
+	return secret, nil
+}
+
+// String returns the share as printable text
+func (share SecretShare) String() string {
+	body := fmt.Sprintf("%s-%s-%d-%d-%s", SecretSharePrefix, share.SecretID, share.Threshold, share.Index, hex.EncodeToString(share.Data))
+	return fmt.Sprintf("%s-%08x", body, crc32.ChecksumIEEE([]byte(body)))
+}
+
+// ParseSecretShare parses a share created by SecretShare.String()
+func ParseSecretShare(s string) (*SecretShare, error) {
+	// Allow line breaks and spaces in printed shares
+	s = strings.Join(strings.Fields(s), "")
+
+	parts := strings.Split(s, "-")
+	if len(parts) != 6 || parts[0] != SecretSharePrefix {
+		return nil, ErrInvalidShare
+	}
+
+	// Verify checksum
+	body := strings.Join(parts[:5], "-")
+	if fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(body))) != strings.ToLower(parts[5]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidShare)
+	}
+
+	threshold, err := strconv.ParseUint(parts[2], 10, 8)
+	if err != nil {
+		return nil, ErrInvalidShare
+	}
+
+	index, err := strconv.ParseUint(parts[3], 10, 8)
+	if err != nil {
+		return nil, ErrInvalidShare
+	}
+
+	data, err := hex.DecodeString(parts[4])
+	if err != nil {
+		return nil, ErrInvalidShare
+	}
+
+	return &SecretShare{
+		SecretID:  parts[1],
+		Threshold: uint8(threshold),
+		Index:     uint8(index),
+		Data:      data,
+	}, nil
+}
@@ -0,0 +1,153 @@
+package libdatamanager
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSplitAndCombineSecret(t *testing.T) {
+	secret := []byte("the master key of the keystore!!")
+
+	tests := []struct {
+		name      string
+		n         int
+		threshold int
+		use       []int
+		wantErr   error
+	}{
+		{name: "all shares", n: 3, threshold: 2, use: []int{0, 1, 2}},
+		{name: "threshold shares", n: 5, threshold: 3, use: []int{4, 0, 2}},
+		{name: "more than threshold", n: 5, threshold: 3, use: []int{0, 1, 2, 3}},
+		{name: "threshold equals count", n: 4, threshold: 4, use: []int{3, 2, 1, 0}},
+		{name: "max shares", n: 255, threshold: 2, use: []int{254, 100}},
+		{name: "not enough shares", n: 5, threshold: 3, use: []int{1, 3}, wantErr: ErrNotEnoughShares},
+		{name: "no shares", n: 3, threshold: 2, wantErr: ErrNotEnoughShares},
+	}
+
+	for _, test := range tests {
+		shares, err := SplitSecret(secret, test.n, test.threshold)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if len(shares) != test.n {
+			t.Fatalf("%s: got %d shares, want %d", test.name, len(shares), test.n)
+		}
+
+		var use []SecretShare
+		for _, i := range test.use {
+			use = append(use, shares[i])
+		}
+
+		combined, err := CombineShares(use)
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+
+		if err == nil && !bytes.Equal(combined, secret) {
+			t.Errorf("%s: got secret %q, want %q", test.name, combined, secret)
+		}
+	}
+}
+
+func TestSplitSecretParams(t *testing.T) {
+	tests := []struct {
+		n         int
+		threshold int
+	}{
+		{3, 1},
+		{3, 4},
+		{256, 2},
+		{0, 0},
+	}
+
+	for _, test := range tests {
+		if _, err := SplitSecret([]byte("secret"), test.n, test.threshold); err != ErrInvalidShareParams {
+			t.Errorf("n=%d threshold=%d: got %v, want ErrInvalidShareParams", test.n, test.threshold, err)
+		}
+	}
+}
+
+func TestCombineSharesRejectsInvalidShares(t *testing.T) {
+	shares, err := SplitSecret([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	others, err := SplitSecret([]byte("other secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := shares[1]
+	tampered.Data = append([]byte{}, tampered.Data...)
+	tampered.Data[0] ^= 1
+
+	tests := []struct {
+		name    string
+		shares  []SecretShare
+		wantErr error
+	}{
+		{"other secret", []SecretShare{shares[0], others[1]}, ErrShareMismatch},
+		{"tampered share", []SecretShare{shares[0], tampered}, ErrShareMismatch},
+		{"zero index", []SecretShare{shares[0], {Threshold: 2, SecretID: shares[0].SecretID, Data: shares[1].Data}}, ErrInvalidShare},
+		{"duplicate share", []SecretShare{shares[0], shares[0]}, nil},
+	}
+
+	for _, test := range tests {
+		secret, err := CombineShares(test.shares)
+		if err == nil {
+			t.Errorf("%s: got secret %q, want an error", test.name, secret)
+			continue
+		}
+
+		if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestParseSecretShare(t *testing.T) {
+	shares, err := SplitSecret([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	printed := shares[2].String()
+
+	tests := []struct {
+		name    string
+		text    string
+		wantErr bool
+	}{
+		{name: "printed", text: printed},
+		{name: "uppercase checksum", text: printed[:len(printed)-8] + strings.ToUpper(printed[len(printed)-8:])},
+		{name: "line breaks", text: printed[:20] + "\n  " + printed[20:] + "\n"},
+		{name: "changed data", text: strings.Replace(printed, "-3-", "-1-", 1), wantErr: true},
+		{name: "wrong prefix", text: "other" + printed[len(SecretSharePrefix):], wantErr: true},
+		{name: "missing part", text: printed[strings.Index(printed, "-")+1:], wantErr: true},
+		{name: "empty", wantErr: true},
+	}
+
+	for _, test := range tests {
+		share, err := ParseSecretShare(test.text)
+		if test.wantErr {
+			if !errors.Is(err, ErrInvalidShare) {
+				t.Errorf("%s: got error %v, want ErrInvalidShare", test.name, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if share.String() != printed {
+			t.Errorf("%s: got share %s, want %s", test.name, share, printed)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package libdatamanager
+
+import "time"
+
+// ListTrash lists all deleted files in namespace
+func (libdm LibDM) ListTrash(namespace string) (*TrashListResponse, error) {
+	var response TrashListResponse
+
+	if _, err := libdm.Request(EPTrash, &FileRequest{
+		Attributes: FileAttributes{
+			Namespace: namespace,
+		},
+	}, &response, true); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// RestoreFile restores the desired file(s) from the trash. If all is
+// true, all deleted files matching attributes are restored
+func (libdm LibDM) RestoreFile(name string, id uint, all bool, attributes FileAttributes) (*IDsResponse, error) {
+	var response IDsResponse
+
+	if _, err := libdm.Request(EPTrashRestore, &FileRequest{
+		Name:       name,
+		FileID:     id,
+		All:        all,
+		Attributes: attributes,
+	}, &response, true); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// PurgeTrash deletes all files in the trash of namespace permanently.
+// If olderThan is > 0, only files deleted before this duration are purged
+func (libdm LibDM) PurgeTrash(namespace string, olderThan time.Duration) (*IDsResponse, error) {
+	var response IDsResponse
+
+	if _, err := libdm.Request(EPTrashPurge, &FileRequest{
+		Attributes: FileAttributes{
+			Namespace: namespace,
+		},
+		OlderThan: int64(olderThan / time.Second),
+	}, &response, true); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
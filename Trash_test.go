@@ -0,0 +1,93 @@
+package libdatamanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTestTrashServer records the raw requests sent to endpoint
+func newTestTrashServer(t *testing.T, endpoint Endpoint) (*LibDM, *map[string]json.RawMessage) {
+	t.Helper()
+
+	var request map[string]json.RawMessage
+	libdm := newTestServer(t, map[Endpoint]interface{}{
+		endpoint: testHandler(func(r *http.Request) interface{} {
+			request = nil
+			json.NewDecoder(r.Body).Decode(&request)
+			return IDsResponse{IDs: []uint{1}}
+		}),
+	})
+
+	return libdm, &request
+}
+
+func TestDeleteFilePermanent(t *testing.T) {
+	tests := []struct {
+		name      string
+		permanent []bool
+		want      string // permanent field sent, empty if omitted
+	}{
+		{name: "default"},
+		{name: "trash", permanent: []bool{false}},
+		{name: "permanent", permanent: []bool{true}, want: "true"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			libdm, request := newTestTrashServer(t, EPFileDelete)
+
+			response, err := libdm.DeleteFile("file", 1, false, FileAttributes{Namespace: "ns"}, test.permanent...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(response.IDs) != 1 {
+				t.Errorf("got IDs %v, want [1]", response.IDs)
+			}
+
+			permanent, ok := (*request)["permanent"]
+			if !ok && len(test.want) > 0 {
+				t.Fatalf("permanent not sent, want %s", test.want)
+			}
+
+			if string(permanent) != test.want {
+				t.Errorf("got permanent %s, want %q", permanent, test.want)
+			}
+		})
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	tests := []struct {
+		name      string
+		olderThan time.Duration
+		want      string // olderthan field sent, empty if omitted
+	}{
+		{name: "all"},
+		{name: "seconds", olderThan: 90 * time.Second, want: "90"},
+		{name: "days", olderThan: 7 * 24 * time.Hour, want: "604800"},
+		{name: "rounded down", olderThan: 1500 * time.Millisecond, want: "1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			libdm, request := newTestTrashServer(t, EPTrashPurge)
+
+			if _, err := libdm.PurgeTrash("ns", test.olderThan); err != nil {
+				t.Fatal(err)
+			}
+
+			if olderThan := (*request)["olderthan"]; string(olderThan) != test.want {
+				t.Errorf("got olderthan %s, want %q", olderThan, test.want)
+			}
+
+			var attributes FileAttributes
+			json.Unmarshal((*request)["attributes"], &attributes)
+			if attributes.Namespace != "ns" {
+				t.Errorf("got namespace %q, want ns", attributes.Namespace)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package libdatamanager
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSourceTooLarge if the content of an url exceeds the max size
+	ErrSourceTooLarge = errors.New("source exceeds max size")
+	// ErrTooManyRedirects if an url redirects more often than allowed
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrSourceRequestFailed if the source of an url responded with an error
+	ErrSourceRequestFailed = errors.New("source request failed")
+	// ErrInvalidDataURL if a data url can't be parsed
+	ErrInvalidDataURL = errors.New("invalid data url")
+	// ErrSourceIsDir if a file url points to a directory
+	ErrSourceIsDir = errors.New("source is a directory")
+	// ErrRemoteFileURL if a file url points to another host
+	ErrRemoteFileURL = errors.New("file url of a remote host")
+)
+
+// Defaults for fetching urls
+const (
+	DefaultURLUserAgent    = "libdatamanager (+https://github.com/DataManager-Go/libdatamanager)"
+	DefaultURLMaxRedirects = 10
+	DefaultURLTimeout      = 30 * time.Second
+)
+
+// URLOptions options for fetching the source of an url upload. Auth and
+// Headers, which may override the User-Agent, are only applied to http(s)
+// urls. MaxRedirects < 0 disables redirects. Timeout limits connecting
+// and waiting for the response headers, but not reading the body.
+// ServerSide lets the server fetch http(s) urls itself
+type URLOptions struct {
+	ServerSide    bool
+	Headers       map[string]string
+	BasicUser     string
+	BasicPassword string
+	BearerToken   string
+	MaxRedirects  int
+	MaxSize       int64
+	Timeout       time.Duration
+}
+
+// urlSource the content of an url
+type urlSource struct {
+	body        io.ReadCloser
+	size        int64
+	name        string
+	contentType string
+}
+
+// WithURLOptions sets the options used by UploadURL
+func (uploadRequest *UploadRequest) WithURLOptions(options URLOptions) *UploadRequest {
+	uploadRequest.URLOptions = options
+	return uploadRequest
+}
+
+// UploadURL fetches the content of u and uploads it. Supported
+// schemes are http, https, file and data. See URLOptions.ServerSide
+func (uploadRequest UploadRequest) UploadURL(u *url.URL, uploadDone chan string, cancel chan bool) (*UploadResponse, error) {
+	if uploadRequest.URLOptions.ServerSide {
+		return uploadRequest.uploadURLServerSide(u, uploadDone, cancel)
+	}
+
+	source, err := uploadRequest.URLOptions.open(u)
+	if err != nil {
+		return nil, err
+	}
+	defer source.body.Close()
+
+	if len(uploadRequest.Name) == 0 {
+		uploadRequest.Name = source.name
+	}
+
+	if len(uploadRequest.FileType) == 0 {
+		uploadRequest.FileType = source.contentType
+	}
+
+	return uploadRequest.UploadFromReader(source.body, source.size, uploadDone, cancel)
+}
+
+// open opens the source of u
+func (options URLOptions) open(u *url.URL) (*urlSource, error) {
+	var source *urlSource
+	var err error
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		source, err = options.openHTTP(u)
+	case "file":
+		source, err = options.openFile(u)
+	case "data":
+		source, err = options.openData(u)
+	default:
+		return nil, ErrUnsupportedScheme
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if options.MaxSize > 0 {
+		if source.size > options.MaxSize {
+			source.body.Close()
+			return nil, ErrSourceTooLarge
+		}
+
+		source.body = &limitedReadCloser{
+			ReadCloser: source.body,
+			left:       options.MaxSize,
+		}
+	}
+
+	return source, nil
+}
+
+// openHTTP requests an http(s) url
+func (options URLOptions) openHTTP(u *url.URL) (*urlSource, error) {
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = DefaultURLTimeout
+	}
+
+	maxRedirects := options.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = DefaultURLMaxRedirects
+	}
+
+	client := http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout: timeout,
+			}).DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// Fail on the redirect response itself
+			if maxRedirects < 0 {
+				return http.ErrUseLastResponse
+			}
+
+			if len(via) > maxRedirects {
+				return ErrTooManyRedirects
+			}
+
+			return nil
+		},
+	}
+
+	// Build a new request
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", DefaultURLUserAgent)
+	for key, value := range options.headers() {
+		req.Header.Set(key, value)
+	}
+
+	// Do the request
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrSourceRequestFailed, resp.Status)
+	}
+
+	// Use the url after following redirects
+	name := contentDispositionName(resp.Header.Get("Content-Disposition"))
+	if len(name) == 0 {
+		name = urlName(resp.Request.URL)
+	}
+
+	size := resp.ContentLength
+	if size < 0 {
+		size = 0
+	}
+
+	return &urlSource{
+		body:        resp.Body,
+		size:        size,
+		name:        name,
+		contentType: resp.Header.Get("Content-Type"),
+	}, nil
+}
+
+// headers returns the custom headers including the auth header
+func (options URLOptions) headers() map[string]string {
+	headers := make(map[string]string, len(options.Headers)+1)
+	for key, value := range options.Headers {
+		headers[key] = value
+	}
+
+	if len(options.BearerToken) > 0 {
+		headers["Authorization"] = "Bearer " + options.BearerToken
+	} else if len(options.BasicUser) > 0 {
+		auth := options.BasicUser + ":" + options.BasicPassword
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
+	}
+
+	return headers
+}
+
+// openFile opens a file url of the local host
+func (options URLOptions) openFile(u *url.URL) (*urlSource, error) {
+	if len(u.Host) > 0 && !strings.EqualFold(u.Host, "localhost") {
+		return nil, ErrRemoteFileURL
+	}
+
+	file := filepath.FromSlash(u.Path)
+	if len(file) == 0 {
+		file = u.Opaque
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if stat.IsDir() {
+		f.Close()
+		return nil, ErrSourceIsDir
+	}
+
+	return &urlSource{
+		body:        f,
+		size:        stat.Size(),
+		name:        stat.Name(),
+		contentType: mime.TypeByExtension(filepath.Ext(file)),
+	}, nil
+}
+
+// openData decodes a data url (RFC 2397)
+func (options URLOptions) openData(u *url.URL) (*urlSource, error) {
+	raw := strings.TrimPrefix(u.String(), u.Scheme+":")
+
+	comma := strings.IndexByte(raw, ',')
+	if comma < 0 {
+		return nil, ErrInvalidDataURL
+	}
+
+	mediaType, data := raw[:comma], raw[comma+1:]
+
+	isBase64 := strings.HasSuffix(strings.ToLower(mediaType), ";base64")
+	if isBase64 {
+		mediaType = mediaType[:len(mediaType)-len(";base64")]
+	}
+
+	if len(mediaType) == 0 || strings.HasPrefix(mediaType, ";") {
+		mediaType = "text/plain" + mediaType
+	}
+
+	content, err := url.PathUnescape(data)
+	if err != nil {
+		return nil, ErrInvalidDataURL
+	}
+
+	if isBase64 {
+		decoded, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return nil, ErrInvalidDataURL
+		}
+
+		content = string(decoded)
+	}
+
+	return &urlSource{
+		body:        ioutil.NopCloser(strings.NewReader(content)),
+		size:        int64(len(content)),
+		name:        "data",
+		contentType: mediaType,
+	}, nil
+}
+
+// contentDispositionName returns the filename of a Content-Disposition header
+func contentDispositionName(header string) string {
+	if len(header) == 0 {
+		return ""
+	}
+
+	_, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return ""
+	}
+
+	// Never use directories of the header
+	name := path.Base(strings.ReplaceAll(params["filename"], `\`, "/"))
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+
+	return name
+}
+
+// urlName returns the last element of the urls path or its hostname
+func urlName(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "." || name == "/" || name == ".." {
+		return u.Hostname()
+	}
+
+	return name
+}
+
+// limitedReadCloser fails reading more than left bytes
+type limitedReadCloser struct {
+	io.ReadCloser
+	left int64
+}
+
+func (reader *limitedReadCloser) Read(p []byte) (int, error) {
+	if reader.left < 0 {
+		return 0, ErrSourceTooLarge
+	}
+
+	// Read one byte more to detect exceeding the limit
+	if int64(len(p)) > reader.left+1 {
+		p = p[:reader.left+1]
+	}
+
+	n, err := reader.ReadCloser.Read(p)
+	reader.left -= int64(n)
+	if reader.left < 0 {
+		return n, ErrSourceTooLarge
+	}
+
+	return n, err
+}
@@ -0,0 +1,139 @@
+package libdatamanager
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestURLOptionsOpenHTTP(t *testing.T) {
+	// Redirects /n to /n-1 until /0 is reached
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+
+		n, _ := strconv.Atoi(r.URL.Path[1:])
+		if n > 0 {
+			http.Redirect(w, r, "/"+strconv.Itoa(n-1), http.StatusFound)
+			return
+		}
+
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		path          string
+		options       URLOptions
+		wantErr       error
+		wantUserAgent string
+	}{
+		{name: "no redirect", path: "/0", wantUserAgent: DefaultURLUserAgent},
+		{name: "default redirects", path: "/10"},
+		{name: "too many redirects", path: "/11", wantErr: ErrTooManyRedirects},
+		{name: "max redirects", path: "/2", options: URLOptions{MaxRedirects: 2}},
+		{name: "exceeding max redirects", path: "/3", options: URLOptions{MaxRedirects: 2}, wantErr: ErrTooManyRedirects},
+		{name: "redirects disabled", path: "/1", options: URLOptions{MaxRedirects: -1}, wantErr: ErrSourceRequestFailed},
+		{name: "no redirect disabled", path: "/0", options: URLOptions{MaxRedirects: -1}},
+		{name: "max size", path: "/0", options: URLOptions{MaxSize: 3}, wantErr: ErrSourceTooLarge},
+		{
+			name:          "custom user agent",
+			path:          "/0",
+			options:       URLOptions{Headers: map[string]string{"User-Agent": "agent"}},
+			wantUserAgent: "agent",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, _ := url.Parse(server.URL + test.path)
+
+			source, err := test.options.open(u)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer source.body.Close()
+
+			content, err := ioutil.ReadAll(source.body)
+			if err != nil || string(content) != "content" {
+				t.Errorf("got content %q (%v)", content, err)
+			}
+
+			if source.name != "0" {
+				t.Errorf("got name %q, want the name after redirects", source.name)
+			}
+
+			if len(test.wantUserAgent) > 0 && userAgent != test.wantUserAgent {
+				t.Errorf("got user agent %q, want %q", userAgent, test.wantUserAgent)
+			}
+		})
+	}
+}
+
+func TestURLOptionsOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dm-url-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file.txt")
+	if err := ioutil.WriteFile(file, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileURL := filepath.ToSlash(file)
+
+	tests := []struct {
+		name        string
+		url         string
+		wantErr     error
+		wantName    string
+		wantContent string
+	}{
+		{name: "file", url: "file://" + fileURL, wantName: "file.txt", wantContent: "content"},
+		{name: "localhost file", url: "file://localhost" + fileURL, wantName: "file.txt", wantContent: "content"},
+		{name: "remote file", url: "file://example.com" + fileURL, wantErr: ErrRemoteFileURL},
+		{name: "dir", url: "file://" + filepath.ToSlash(dir), wantErr: ErrSourceIsDir},
+		{name: "data", url: "data:,hello%20world", wantName: "data", wantContent: "hello world"},
+		{name: "base64 data", url: "data:text/plain;base64,aGVsbG8=", wantName: "data", wantContent: "hello"},
+		{name: "invalid data", url: "data:text/plain", wantErr: ErrInvalidDataURL},
+		{name: "unsupported scheme", url: "ftp://example.com/file", wantErr: ErrUnsupportedScheme},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			source, err := URLOptions{}.open(u)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer source.body.Close()
+
+			content, err := ioutil.ReadAll(source.body)
+			if err != nil || string(content) != test.wantContent {
+				t.Errorf("got content %q (%v), want %q", content, err, test.wantContent)
+			}
+
+			if source.name != test.wantName {
+				t.Errorf("got name %q, want %q", source.name, test.wantName)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package libdatamanager
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrServerFetchEncrypted if a server side url upload should be encrypted
+	ErrServerFetchEncrypted = errors.New("server side url uploads can't be encrypted")
+	// ErrUploadJobFailed if a server side upload job failed
+	ErrUploadJobFailed = errors.New("upload job failed")
+)
+
+// UploadJobPollInterval interval for polling the status of upload jobs
+var UploadJobPollInterval = time.Second
+
+// UploadJobMaxRetries count of consecutive failed status requests
+// before WaitUploadJob gives up. The delay doubles on each retry
+var UploadJobMaxRetries = 5
+
+// UploadJobError if waiting for an upload job failed. The
+// job may still be running and can be waited for again
+type UploadJobError struct {
+	JobID string
+	Err   error
+}
+
+func (jerr *UploadJobError) Error() string {
+	return fmt.Sprintf("upload job %s: %v", jerr.JobID, jerr.Err)
+}
+
+// Unwrap returns the underlying error
+func (jerr *UploadJobError) Unwrap() error {
+	return jerr.Err
+}
+
+// UploadJobCallback gets called on changes of an upload jobs status
+type UploadJobCallback func(UploadJobStatus)
+
+// Finished returns true if the job won't change anymore
+func (status UploadJobStatus) Finished() bool {
+	return status.State == UploadJobDone || status.State == UploadJobFailed || status.State == UploadJobCancelled
+}
+
+// Err returns the error of a failed or cancelled job
+func (status UploadJobStatus) Err() error {
+	switch status.State {
+	case UploadJobFailed:
+		return fmt.Errorf("%w: %s", ErrUploadJobFailed, status.Error)
+	case UploadJobCancelled:
+		return ErrCancelled
+	}
+
+	return nil
+}
+
+// SubmitURL lets the server fetch and upload the content of u without
+// relaying it through the client. Only http(s) urls are supported
+// and the content can't be encrypted on the client
+func (uploadRequest UploadRequest) SubmitURL(u *url.URL) (*UploadJobResponse, error) {
+	if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
+		return nil, ErrUnsupportedScheme
+	}
+
+	if uploadRequest.Encryption != 0 {
+		return nil, ErrServerFetchEncrypted
+	}
+
+	if len(uploadRequest.Name) == 0 {
+		uploadRequest.Name = urlName(u)
+	}
+
+	request := uploadRequest.BuildRequestStruct(URLUploadType)
+	request.URL = u.String()
+	request.URLHeaders = uploadRequest.URLOptions.headers()
+	request.URLMaxSize = uploadRequest.URLOptions.MaxSize
+
+	var resp UploadJobResponse
+	if _, err := uploadRequest.Request(EPUploadURL, request, &resp, true); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetUploadJob returns the status of an upload job
+func (libdm LibDM) GetUploadJob(jobID string) (*UploadJobStatus, error) {
+	var resp UploadJobStatus
+	if _, err := libdm.Request(EPUploadJob, &UploadJobRequest{
+		JobID: jobID,
+	}, &resp, true); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// CancelUploadJob cancels a pending or running upload job
+func (libdm LibDM) CancelUploadJob(jobID string) error {
+	_, err := libdm.Request(EPUploadJobCancel, &UploadJobRequest{
+		JobID: jobID,
+	}, nil, true)
+
+	return err
+}
+
+// WaitUploadJob polls the status of an upload job until it's finished.
+// callback gets called if the status changes and may be nil. The job
+// gets cancelled if cancel receives a value. Temporary errors are
+// retried up to UploadJobMaxRetries times. If polling or cancelling
+// fails, an *UploadJobError containing the job ID is returned
+func (libdm LibDM) WaitUploadJob(jobID string, callback UploadJobCallback, cancel chan bool) (*UploadResponse, error) {
+	var last UploadJobStatus
+	var retries int
+	for {
+		delay := UploadJobPollInterval
+
+		status, err := libdm.GetUploadJob(jobID)
+		switch {
+		case err == nil:
+			retries = 0
+
+			if callback != nil && (status.State != last.State || status.BytesFetched != last.BytesFetched) {
+				callback(*status)
+			}
+			last = *status
+
+			if status.Finished() {
+				if err := status.Err(); err != nil {
+					return nil, err
+				}
+
+				return status.Upload, nil
+			}
+		case isTemporaryError(err) && retries < UploadJobMaxRetries:
+			// Back off while the server is unavailable
+			retries++
+			if delay <<= uint(retries); delay > MaxRetryDelay {
+				delay = MaxRetryDelay
+			}
+		default:
+			return nil, &UploadJobError{JobID: jobID, Err: err}
+		}
+
+		select {
+		case <-cancel:
+			if err := libdm.CancelUploadJob(jobID); err != nil {
+				return nil, &UploadJobError{JobID: jobID, Err: err}
+			}
+
+			return nil, ErrCancelled
+		case <-time.After(delay):
+		}
+	}
+}
+
+// uploadURLServerSide submits u as upload job and waits for it
+func (uploadRequest UploadRequest) uploadURLServerSide(u *url.URL, uploadDone chan string, cancel chan bool) (*UploadResponse, error) {
+	tracker := newProgressTracker(uploadRequest.progress, PhaseFetching, 0)
+
+	resp, err := uploadRequest.submitAndWait(u, tracker, cancel)
+
+	var checksum string
+	if resp != nil {
+		checksum = resp.Checksum
+	}
+	tracker.finish(checksum, err)
+
+	go func() {
+		uploadDone <- checksum
+	}()
+
+	return resp, err
+}
+
+// submitAndWait submits u and reports the fetched bytes to tracker
+func (uploadRequest UploadRequest) submitAndWait(u *url.URL, tracker *progressTracker, cancel chan bool) (*UploadResponse, error) {
+	job, err := uploadRequest.SubmitURL(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return uploadRequest.WaitUploadJob(job.JobID, func(status UploadJobStatus) {
+		tracker.setProgress(status.BytesFetched, status.Size)
+	}, cancel)
+}
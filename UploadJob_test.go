@@ -0,0 +1,82 @@
+package libdatamanager
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWaitUploadJobRetries(t *testing.T) {
+	defer func(interval time.Duration, retries int) {
+		UploadJobPollInterval = interval
+		UploadJobMaxRetries = retries
+	}(UploadJobPollInterval, UploadJobMaxRetries)
+	UploadJobPollInterval = time.Millisecond
+	UploadJobMaxRetries = 2
+
+	tests := []struct {
+		name         string
+		codes        []int
+		body         string // error body, JSON if empty
+		wantRequests int
+		wantJobErr   bool
+	}{
+		{name: "running", codes: []int{200, 200}, wantRequests: 3},
+		{name: "server errors", codes: []int{500, 503, 200}, wantRequests: 4},
+		{name: "rate limited", codes: []int{429}, wantRequests: 2},
+		{name: "proxy errors", codes: []int{502, 503}, body: "<html>Bad Gateway</html>", wantRequests: 3},
+		{name: "too many proxy errors", codes: []int{502, 502, 502}, body: "<html>Bad Gateway</html>", wantRequests: 3, wantJobErr: true},
+		{name: "too many errors", codes: []int{500, 500, 500}, wantRequests: 3, wantJobErr: true},
+		{name: "retries reset", codes: []int{500, 500, 200, 500, 500}, wantRequests: 6},
+		{name: "not found", codes: []int{404}, wantRequests: 1, wantJobErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests int
+			var mx sync.Mutex
+
+			// Respond with the given codes, the job is done afterwards
+			libdm := newTestServer(t, map[Endpoint]interface{}{
+				EPUploadJob: testHandler(func(r *http.Request) interface{} {
+					mx.Lock()
+					defer mx.Unlock()
+
+					requests++
+					if requests > len(test.codes) {
+						return UploadJobStatus{JobID: "job", State: UploadJobDone, Upload: &UploadResponse{FileID: 1}}
+					}
+
+					if code := test.codes[requests-1]; code != http.StatusOK {
+						return testStatus{code: code, body: test.body}
+					}
+
+					return UploadJobStatus{JobID: "job", State: UploadJobRunning}
+				}),
+			})
+
+			resp, err := libdm.WaitUploadJob("job", nil, nil)
+
+			var jobErr *UploadJobError
+			if errors.As(err, &jobErr) != test.wantJobErr {
+				t.Fatalf("got error %v, want UploadJobError: %v", err, test.wantJobErr)
+			}
+
+			if test.wantJobErr {
+				if jobErr.JobID != "job" {
+					t.Errorf("got job ID %q, want job", jobErr.JobID)
+				}
+			} else if err != nil || resp == nil || resp.FileID != 1 {
+				t.Errorf("got response %v (%v), want file 1", resp, err)
+			}
+
+			mx.Lock()
+			defer mx.Unlock()
+			if requests != test.wantRequests {
+				t.Errorf("got %d requests, want %d", requests, test.wantRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package libdatamanager
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventType type of a change event
+type EventType string
+
+// Event types
+const (
+	EventFileCreated      EventType = "file.created"
+	EventFileReplaced     EventType = "file.replaced"
+	EventFileRenamed      EventType = "file.renamed"
+	EventFileTagged       EventType = "file.tagged"
+	EventFileDeleted      EventType = "file.deleted"
+	EventFilePublished    EventType = "file.published"
+	EventNamespaceCreated EventType = "namespace.created"
+	EventNamespaceRenamed EventType = "namespace.renamed"
+	EventNamespaceDeleted EventType = "namespace.deleted"
+)
+
+const (
+	// DefaultRetryDelay delay before reconnecting a watcher
+	DefaultRetryDelay = 2 * time.Second
+
+	// MaxRetryDelay max delay before reconnecting a watcher
+	MaxRetryDelay = 2 * time.Minute
+)
+
+// Event a change in a namespace. ID can be used as cursor
+// to resume watching after this event
+type Event struct {
+	ID        string            `json:"-"`
+	Type      EventType         `json:"-"`
+	Time      time.Time         `json:"time"`
+	Namespace string            `json:"ns"`
+	FileID    uint              `json:"fileID,omitempty"`
+	File      *FileResponseItem `json:"file,omitempty"`
+	OldName   string            `json:"oldName,omitempty"`
+}
+
+// Watcher subscribes to events of a namespace
+type Watcher struct {
+	LibDM
+	Namespace     string
+	AllNamespaces bool
+	Types         []EventType
+	Cursor        string
+	RetryDelay    time.Duration
+}
+
+// NewWatcher create a new watcher for events in namespace
+func (libdm LibDM) NewWatcher(namespace string) *Watcher {
+	return &Watcher{
+		LibDM:      libdm,
+		Namespace:  namespace,
+		RetryDelay: DefaultRetryDelay,
+	}
+}
+
+// WatchAllNamespaces receive events of all namespaces
+func (watcher *Watcher) WatchAllNamespaces() *Watcher {
+	watcher.AllNamespaces = true
+	return watcher
+}
+
+// FromCursor only receive events after the event with the given ID
+func (watcher *Watcher) FromCursor(cursor string) *Watcher {
+	watcher.Cursor = cursor
+	return watcher
+}
+
+// OnlyTypes only receive events of the given types
+func (watcher *Watcher) OnlyTypes(types ...EventType) *Watcher {
+	watcher.Types = types
+	return watcher
+}
+
+// Watch receives events until cancel receives a value. Lost connections are
+// reestablished, resuming after the last received event. Connection errors
+// and malformed events, which get skipped, are sent to the error channel.
+// Both channels are closed if the watcher stops, which happens on cancel
+// or if the server rejects the request. Rate limited requests are retried
+// after the delay requested by the server
+func (watcher *Watcher) Watch(cancel chan bool) (<-chan Event, <-chan error) {
+	events := make(chan Event, 16)
+	errs := make(chan error, 1)
+
+	// Closed once cancel received a value, so
+	// every goroutine notices the cancellation
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-cancel:
+			close(stop)
+		case <-done:
+		}
+	}()
+
+	// Don't block on unread errors
+	report := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+
+	go func() {
+		defer close(done)
+		defer close(events)
+		defer close(errs)
+
+		delay := watcher.getRetryDelay()
+		for {
+			received, retryAfter, fatal, err := watcher.stream(events, stop, report)
+			if err == ErrCancelled {
+				return
+			}
+
+			if err != nil {
+				report(err)
+			}
+
+			if fatal {
+				return
+			}
+
+			// Reset backoff after a working connection
+			if received {
+				delay = watcher.getRetryDelay()
+			}
+
+			wait := delay
+			if retryAfter > wait {
+				wait = retryAfter
+			}
+
+			select {
+			case <-stop:
+				return
+			case <-time.After(wait):
+			}
+
+			if delay *= 2; delay > MaxRetryDelay {
+				delay = MaxRetryDelay
+			}
+		}
+	}()
+
+	return events, errs
+}
+
+func (watcher *Watcher) getRetryDelay() time.Duration {
+	if watcher.RetryDelay <= 0 {
+		return DefaultRetryDelay
+	}
+
+	return watcher.RetryDelay
+}
+
+// stream connects to the server and sends received events to events.
+// retryAfter is the delay requested by the server if it's rate limited
+func (watcher *Watcher) stream(events chan Event, stop chan struct{}, report func(error)) (received bool, retryAfter time.Duration, fatal bool, err error) {
+	resp, err := watcher.NewRequest(EPEvents, &WatchRequest{
+		Namespace:     watcher.Namespace,
+		AllNamespaces: watcher.AllNamespaces,
+		Cursor:        watcher.Cursor,
+		Types:         watcher.Types,
+	}).WithAuthFromConfig().
+		WithHeader("Accept", "text/event-stream").
+		DoHTTPRequest()
+	if err != nil {
+		return false, 0, false, NewErrorFromResponse(nil, err)
+	}
+
+	// Close body on cancel to stop blocking reads
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		response := &RestRequestResponse{
+			HTTPCode: resp.StatusCode,
+			Headers:  &resp.Header,
+			Status:   ResponseError,
+		}
+
+		var errRes ErrorResponse
+		if d, err := ioutil.ReadAll(resp.Body); err == nil && json.Unmarshal(d, &errRes) == nil {
+			response.Message = errRes.Message
+		}
+
+		// Retrying only makes sense on server errors and rate limits
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return false, parseRetryAfter(resp.Header.Get("Retry-After")), false, NewErrorFromResponse(response)
+		}
+
+		return false, 0, resp.StatusCode < 500, NewErrorFromResponse(response)
+	}
+
+	var event Event
+	var data strings.Builder
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Blank line dispatches the event
+		if len(line) == 0 {
+			if data.Len() > 0 {
+				// Skip malformed events, resuming
+				// at them would replay them forever
+				if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+					report(fmt.Errorf("skipped malformed event %s: %w", event.ID, err))
+				} else {
+					select {
+					case events <- event:
+					case <-stop:
+						return received, 0, false, ErrCancelled
+					}
+				}
+
+				received = true
+				if len(event.ID) > 0 {
+					watcher.Cursor = event.ID
+				}
+			}
+
+			event = Event{}
+			data.Reset()
+			continue
+		}
+
+		// Comments are used as keepalive
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "id":
+			event.ID = value
+		case "event":
+			event.Type = EventType(value)
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+				watcher.RetryDelay = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	// Check whether the stream was cancelled
+	select {
+	case <-stop:
+		return received, 0, false, ErrCancelled
+	default:
+	}
+
+	if err := scanner.Err(); err != nil {
+		return received, 0, false, err
+	}
+
+	return received, 0, false, nil
+}
+
+// parseRetryAfter returns the delay of a Retry-After
+// header, which is given in seconds or as date
+func parseRetryAfter(header string) time.Duration {
+	if len(header) == 0 {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,218 @@
+package libdatamanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// watchTestResponse a response of the test event server. Streams
+// are written as they are, other codes are sent as error
+type watchTestResponse struct {
+	code       int
+	retryAfter string
+	stream     string
+}
+
+// runTestWatcher watches a server sending responses and returns the
+// received events, errors and the cursors sent on each connection
+func runTestWatcher(t *testing.T, responses []watchTestResponse) ([]Event, []error, []string) {
+	t.Helper()
+
+	var cursors []string
+	var mx sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		defer mx.Unlock()
+
+		var request WatchRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		cursors = append(cursors, request.Cursor)
+
+		// Stop the watcher after the last response
+		response := watchTestResponse{code: http.StatusNotFound}
+		if len(cursors) <= len(responses) {
+			response = responses[len(cursors)-1]
+		}
+
+		if len(response.retryAfter) > 0 {
+			w.Header().Set("Retry-After", response.retryAfter)
+		}
+
+		if response.code != http.StatusOK {
+			w.WriteHeader(response.code)
+			json.NewEncoder(w).Encode(ErrorResponse{Message: "error"})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, response.stream)
+	}))
+	defer server.Close()
+
+	watcher := NewLibDM(&RequestConfig{URL: server.URL}).NewWatcher("ns")
+	watcher.RetryDelay = time.Millisecond
+
+	cancel := make(chan bool, 1)
+	eventChan, errChan := watcher.Watch(cancel)
+
+	var received []Event
+	var errs []error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for err := range errChan {
+			errs = append(errs, err)
+		}
+	}()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case event, ok := <-eventChan:
+			if !ok {
+				wg.Wait()
+
+				mx.Lock()
+				defer mx.Unlock()
+				return received, errs, cursors
+			}
+
+			received = append(received, event)
+		case <-timeout:
+			cancel <- true
+			t.Fatal("watcher didn't stop")
+		}
+	}
+}
+
+func TestWatcherParsesEvents(t *testing.T) {
+	tests := []struct {
+		name        string
+		responses   []watchTestResponse
+		wantIDs     []string
+		wantErrs    int
+		wantCursors []string
+	}{
+		{
+			name: "events",
+			responses: []watchTestResponse{{code: 200, stream: "" +
+				": keepalive\n\n" +
+				"id: 1\nevent: file.created\ndata: {\"ns\":\"ns\",\"fileID\":1}\n\n" +
+				"id: 2\nevent: file.renamed\ndata: {\"ns\":\"ns\",\n" +
+				"data: \"oldName\":\"old\"}\n\n",
+			}},
+			wantIDs:     []string{"1", "2"},
+			wantErrs:    1,
+			wantCursors: []string{"", "2"},
+		},
+		{
+			name: "malformed event",
+			responses: []watchTestResponse{{code: 200, stream: "" +
+				"id: 1\nevent: file.created\ndata: {\"ns\":\"ns\"}\n\n" +
+				"id: 2\nevent: file.created\ndata: {broken\n\n" +
+				"id: 3\nevent: file.deleted\ndata: {\"ns\":\"ns\"}\n\n",
+			}},
+			wantIDs:     []string{"1", "3"},
+			wantErrs:    2,
+			wantCursors: []string{"", "3"},
+		},
+		{
+			name: "malformed last event",
+			responses: []watchTestResponse{{code: 200, stream: "" +
+				"id: 1\nevent: file.created\ndata: {broken\n\n",
+			}},
+			wantErrs:    2,
+			wantCursors: []string{"", "1"},
+		},
+		{
+			name: "reconnect",
+			responses: []watchTestResponse{
+				{code: 200, stream: "id: 1\nevent: file.created\ndata: {}\n\n"},
+				{code: 502},
+				{code: 200, stream: "id: 2\nevent: file.deleted\ndata: {}\n\n"},
+			},
+			wantIDs:     []string{"1", "2"},
+			wantErrs:    2,
+			wantCursors: []string{"", "1", "1", "2"},
+		},
+		{
+			name:        "rejected",
+			wantErrs:    1,
+			wantCursors: []string{""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, errs, cursors := runTestWatcher(t, test.responses)
+
+			var ids []string
+			for _, event := range events {
+				ids = append(ids, event.ID)
+			}
+
+			if fmt.Sprint(ids) != fmt.Sprint(test.wantIDs) {
+				t.Errorf("got events %v, want %v", ids, test.wantIDs)
+			}
+
+			// Errors are dropped if they aren't read in time
+			if len(errs) == 0 || len(errs) > test.wantErrs {
+				t.Errorf("got errors %v, want up to %d", errs, test.wantErrs)
+			}
+
+			if fmt.Sprint(cursors) != fmt.Sprint(test.wantCursors) {
+				t.Errorf("got cursors %q, want %q", cursors, test.wantCursors)
+			}
+		})
+	}
+}
+
+func TestWatcherRetriesRateLimits(t *testing.T) {
+	start := time.Now()
+	_, errs, cursors := runTestWatcher(t, []watchTestResponse{
+		{code: http.StatusTooManyRequests, retryAfter: "1"},
+	})
+
+	if len(cursors) != 2 {
+		t.Fatalf("got %d requests, want a retry", len(cursors))
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want Retry-After to be honored", elapsed)
+	}
+
+	var resErr *ResponseErr
+	if len(errs) == 0 || !errors.As(errs[0], &resErr) || resErr.Response.HTTPCode != http.StatusTooManyRequests {
+		t.Errorf("got errors %v, want the rate limit", errs)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"", 0, 0},
+		{"0", 0, 0},
+		{"-5", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{"invalid", 0, 0},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 59 * time.Minute, time.Hour},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+	}
+
+	for _, test := range tests {
+		if delay := parseRetryAfter(test.header); delay < test.min || delay > test.max {
+			t.Errorf("%q: got %v, want %v to %v", test.header, delay, test.min, test.max)
+		}
+	}
+}
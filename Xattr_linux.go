@@ -0,0 +1,115 @@
+package libdatamanager
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// Whence values to find data and holes in sparse files
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// readXattrs returns the extended attributes of file
+func readXattrs(file string) (map[string]string, error) {
+	size, err := syscall.Listxattr(file, nil)
+	if err != nil || size == 0 {
+		return nil, ignoreXattrErr(err)
+	}
+
+	buf := make([]byte, size)
+	if size, err = syscall.Listxattr(file, buf); err != nil {
+		return nil, ignoreXattrErr(err)
+	}
+
+	xattrs := make(map[string]string)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+
+		size, err := syscall.Getxattr(file, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		value := make([]byte, size)
+		if size, err = syscall.Getxattr(file, string(name), value); err != nil {
+			return nil, err
+		}
+
+		xattrs[string(name)] = string(value[:size])
+	}
+
+	return xattrs, nil
+}
+
+// writeXattrs sets the extended attributes of file
+func writeXattrs(file string, xattrs map[string]string) error {
+	for name, value := range xattrs {
+		if err := syscall.Setxattr(file, name, []byte(value), 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ignoreXattrErr ignores errors of filesystems without xattr support
+func ignoreXattrErr(err error) error {
+	if errors.Is(err, syscall.ENOTSUP) {
+		return nil
+	}
+
+	return err
+}
+
+// sparseSegments returns the data segments of f or
+// nil if f has no holes
+func sparseSegments(f *os.File, fi os.FileInfo) ([]sparseSegment, error) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || stat.Blocks*512 >= fi.Size() {
+		return nil, nil
+	}
+
+	var segments []sparseSegment
+	var offset int64
+	size := fi.Size()
+
+	for offset < size {
+		data, err := f.Seek(offset, seekData)
+		if err != nil {
+			// No more data after offset
+			if errors.Is(err, syscall.ENXIO) {
+				break
+			}
+
+			return nil, err
+		}
+
+		hole, err := f.Seek(data, seekHole)
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, sparseSegment{
+			Offset: data,
+			Length: hole - data,
+		})
+		offset = hole
+	}
+
+	// Mark trailing holes using an empty segment
+	if len(segments) == 0 || offset < size {
+		segments = append(segments, sparseSegment{
+			Offset: size,
+		})
+	}
+
+	_, err := f.Seek(0, io.SeekStart)
+	return segments, err
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package libdatamanager
+
+import "os"
+
+// readXattrs xattrs are not supported on this OS
+func readXattrs(file string) (map[string]string, error) {
+	return nil, nil
+}
+
+// writeXattrs xattrs are not supported on this OS
+func writeXattrs(file string, xattrs map[string]string) error {
+	return nil
+}
+
+// sparseSegments holes can't be detected on this OS
+func sparseSegments(f *os.File, fi os.FileInfo) ([]sparseSegment, error) {
+	return nil, nil
+}
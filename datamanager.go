@@ -4,6 +4,8 @@ package libdatamanager
 type LibDM struct {
 	Config                *RequestConfig
 	MaxConnectionsPerHost int
+	Keystore              *Keystore
+	RateLimiter           *RateLimiter
 }
 
 // NewLibDM create new libDM "class"
@@ -19,6 +21,30 @@ func (libdm *LibDM) WithMaxConnections(maxConnecetions int) *LibDM {
 	return libdm
 }
 
+// WithKeystore use ks to store keys of encrypted uploads
+// and to look up keys of encrypted downloads
+func (libdm *LibDM) WithKeystore(ks *Keystore) *LibDM {
+	libdm.Keystore = ks
+	return libdm
+}
+
+// WithRateLimit limits the bandwidth of all uploads and
+// downloads to bytesPerSec. Use RateLimiter.SetLimit to change it
+func (libdm *LibDM) WithRateLimit(bytesPerSec, burst int64) *LibDM {
+	libdm.RateLimiter = NewRateLimiter(bytesPerSec, burst)
+	return libdm
+}
+
+// getKeystore returns the keystore scoped to
+// the current server and user or nil
+func (libdm LibDM) getKeystore() *Keystore {
+	if libdm.Keystore == nil {
+		return nil
+	}
+
+	return libdm.Keystore.WithRequestConfig(libdm.Config)
+}
+
 // Request do a request using libdm
 func (libdm LibDM) Request(ep Endpoint, payload, response interface{}, authorized bool) (*RestRequestResponse, error) {
 	req := libdm.NewRequest(ep, payload)
@@ -7,7 +7,7 @@ require (
 	filippo.io/edwards25519 v1.0.0-alpha.2 // indirect
 	github.com/JojiiOfficial/gaw v1.2.8
 	github.com/jinzhu/gorm v1.9.16
-	github.com/klauspost/compress v1.11.12 // indirect
+	github.com/klauspost/compress v1.11.12
 	github.com/klauspost/pgzip v1.2.5
 	github.com/sergi/go-diff v1.1.0 // indirect
 	golang.org/x/crypto v0.0.0-20210314154223-e6e6c4f2bb5b // indirect